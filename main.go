@@ -8,12 +8,20 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
 	"github.com/gorilla/mux"
 	"github.com/nvml-exporter/pkg/collector"
+	"github.com/nvml-exporter/pkg/dcgm"
 	"github.com/nvml-exporter/pkg/debug"
+	"github.com/nvml-exporter/pkg/jobreport"
+	"github.com/nvml-exporter/pkg/otlp"
+	"github.com/nvml-exporter/pkg/remotewrite"
+	"github.com/nvml-exporter/pkg/sink"
+	"github.com/nvml-exporter/pkg/textfile"
 	"gopkg.in/yaml.v2"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -26,7 +34,26 @@ var (
 	metricConfigFile = flag.String("metric-config-file", "", "metric to export file")
 	collectInterval  = flag.Int("collect-interval", 5, "interval to collect metrics")
 	useSlurm         = flag.Bool("use-slurm", false, "use slurm to get process info")
+	metricNaming     = flag.String("metric-naming", collector.NamingLegacy, "metric names, legacy, v2 (prometheus conventions), both (legacy and v2) or dcgm (as dcgm-exporter)")
+	rescanInterval   = flag.Int("rescan-interval", 60, "seconds between rescans of the gpus, to reacquire lost gpus and pick up new ones, 0 disables rescans")
+	gpuLabel         = flag.String("gpu-label", collector.GPULabelIndex, "value of the gpu label, index (nvml), minor (/dev/nvidiaN), pciBusID or uuid")
+	dcgmAddress      = flag.String("dcgm-address", "", "DCGM host engine address to read profiling metrics from, e.g. localhost:5555, NVML only if empty")
 	debugLog         = flag.Bool("debug", false, "debug log level")
+	textfileDir      = flag.String("textfile-dir", "", "node_exporter textfile collector directory to write metrics to, disabled if empty")
+	textfileName     = flag.String("textfile-name", "nvml-exporter.prom", "file name written in textfile-dir")
+	disableHTTP      = flag.Bool("disable-http", false, "do not serve /metrics, only write to textfile-dir")
+	once             = flag.Bool("once", false, "collect once, write to textfile-dir and exit, e.g. for slurm epilog")
+	jobReportDir     = flag.String("job-report-dir", "", "directory to write a json usage report of every finished slurm job to, requires -use-slurm")
+	jobReportKeep    = flag.Int("job-report-keep", 100, "number of recent job reports served on /debug/jobs")
+	jobReportGrace   = flag.Int("job-report-grace", 120, "seconds a slurm job must be gone from the gpus before its report is produced")
+
+	remoteWriteURL        = flag.String("remote-write-url", "", "prometheus remote write endpoint to push metrics to, disabled if empty")
+	remoteWriteBatchSize  = flag.Int("remote-write-batch-size", 500, "max series per remote write request")
+	remoteWriteQueueSize  = flag.Int("remote-write-queue-size", 10000, "max series buffered in memory before dropping")
+	remoteWriteMaxRetries = flag.Int("remote-write-max-retries", 3, "retries of a failed remote write request")
+	remoteWriteTimeout    = flag.Int("remote-write-timeout", 10, "timeout in seconds of a remote write request")
+	remoteWriteSpoolDir   = flag.String("remote-write-spool-dir", "", "dir to keep failed remote write requests in until the endpoint is back, disabled if empty")
+	remoteWriteSpoolSize  = flag.Int("remote-write-spool-size", 512, "max MB of failed remote write requests kept in remote-write-spool-dir")
 )
 
 // todo: helper
@@ -48,22 +75,44 @@ func main() {
 	config := &collector.Config{
 		ServerPort:      *server_port,
 		CollectInterval: *collectInterval,
+		RescanInterval:  *rescanInterval,
 		UseSlurm:        *useSlurm,
 		// SupportedMetrics []string,
 		HostName: hostname,
+		Naming:   *metricNaming,
+		GPULabel: *gpuLabel,
+	}
+	switch config.Naming {
+	case collector.NamingLegacy, collector.NamingV2, collector.NamingBoth, collector.NamingDCGM:
+	default:
+		logrus.Fatalf("Unknown -metric-naming: %v", config.Naming)
+	}
+	switch config.GPULabel {
+	case collector.GPULabelIndex, collector.GPULabelMinor, collector.GPULabelPCIBusID, collector.GPULabelUUID:
+	default:
+		logrus.Fatalf("Unknown -gpu-label: %v", config.GPULabel)
 	}
+	fileConfig := &FileConfig{}
 	if *metricConfigFile != "" {
-		metrics, err := parseMetricsConfig(*metricConfigFile)
+		fileConfig, err = parseMetricsConfig(*metricConfigFile)
 		if err != nil {
 			logrus.Fatalf("Failed to init config file, %v", err)
 			os.Exit(1)
 		} else {
-			config.SupportedMetrics = metrics
+			config.SupportedMetrics = fileConfig.MetricName
+			config.DCGMCounters = fileConfig.dcgmCounters
+			config.Labels = fileConfig.Labels
+			config.Cardinality = fileConfig.Cardinality
+			config.Redaction = fileConfig.Redaction
+			config.GPUFilter = fileConfig.GPUs
 		}
 	}
-	// setup signals
-	stop := make(chan interface{})
-	sigs := newOSWatcher(syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+	if err := config.Cardinality.Validate(config.UseSlurm); err != nil {
+		logrus.Fatalf("Invalid cardinality config, %v", err)
+	}
+	if (*once || *disableHTTP) && *textfileDir == "" {
+		logrus.Fatalf("-once and -disable-http require -textfile-dir")
+	}
 
 	// run nvml cache
 	nvmlCache, err := collector.NewNVMLCache(config)
@@ -72,6 +121,101 @@ func main() {
 		os.Exit(1)
 	}
 
+	// setup collectors
+	procCollector := collector.NewProcessCollector(config, nvmlCache)
+	gpuCollector := collector.NewGPUCollector(config, nvmlCache)
+
+	// after the collectors, which narrow the metrics to the configured ones
+	if *dcgmAddress != "" {
+		backend, err := dcgm.Connect(*dcgmAddress, time.Duration(*collectInterval)*time.Second, collector.SupportedGGPUMetricsName)
+		if err != nil {
+			logrus.Warnf("Profiling metrics fall back to nvml, %v", err)
+		} else {
+			defer backend.Close()
+			nvmlCache.SetProfilingBackend(backend)
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+
+	registry.MustRegister(procCollector, gpuCollector)
+
+	if *textfileDir != "" {
+		writer := textfile.NewWriter(registry, *textfileDir, *textfileName)
+		if *once {
+			defer nvml.Shutdown()
+			if err := nvmlCache.Update(); err != nil {
+				logrus.Fatalf("Failed to collect metrics, err: %v", err)
+			}
+			if err := writer.Write(); err != nil {
+				logrus.Fatalf("Failed to write textfile, err: %v", err)
+			}
+			logrus.Infof("Metrics written to %v", writer.Path())
+			return
+		}
+		nvmlCache.AddUpdateHook(writer.OnUpdate)
+	}
+
+	// setup signals
+	stop := make(chan interface{})
+	sigs := newOSWatcher(syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+
+	var rwClient *remotewrite.Client
+	if *remoteWriteURL != "" {
+		rwClient, err = remotewrite.NewClient(remotewrite.Config{
+			URL:        *remoteWriteURL,
+			BatchSize:  *remoteWriteBatchSize,
+			QueueSize:  *remoteWriteQueueSize,
+			MaxRetries: *remoteWriteMaxRetries,
+			Timeout:    time.Second * time.Duration(*remoteWriteTimeout),
+			SpoolDir:   *remoteWriteSpoolDir,
+			SpoolSize:  int64(*remoteWriteSpoolSize) << 20,
+		}, registry, nvmlCache)
+		if err != nil {
+			logrus.Fatalf("Failed to init remote write client, err: %v", err)
+		}
+		nvmlCache.AddUpdateHook(rwClient.OnUpdate)
+		go rwClient.Run(stop)
+		logrus.Infof("Remote write to %v", *remoteWriteURL)
+	}
+
+	var otlpExporter *otlp.Exporter
+	if fileConfig.OTLP.Endpoint != "" {
+		otlpExporter, err = otlp.NewExporter(fileConfig.OTLP, config, nvmlCache)
+		if err != nil {
+			logrus.Fatalf("Failed to init otlp exporter, err: %v", err)
+		}
+		nvmlCache.AddUpdateHook(otlpExporter.OnUpdate)
+		go otlpExporter.Run(stop)
+		logrus.Infof("OTLP export to %v", fileConfig.OTLP.Endpoint)
+	}
+
+	var jobTracker *jobreport.Tracker
+	if *useSlurm {
+		jobTracker, err = jobreport.NewTracker(jobreport.Config{
+			Dir:   *jobReportDir,
+			Keep:  *jobReportKeep,
+			Grace: time.Second * time.Duration(*jobReportGrace),
+		}, nvmlCache)
+		if err != nil {
+			logrus.Fatalf("Failed to init job report, err: %v", err)
+		}
+		nvmlCache.AddUpdateHook(jobTracker.OnUpdate)
+	} else if *jobReportDir != "" {
+		logrus.Errorf("-job-report-dir requires -use-slurm, job report disabled")
+	}
+
+	sinks, err := sink.NewSinks(fileConfig.Sinks)
+	if err != nil {
+		logrus.Fatalf("Failed to init sinks, err: %v", err)
+	}
+	var sinkManager *sink.Manager
+	if len(sinks) > 0 {
+		sinkManager = sink.NewManager(nvmlCache, sinks)
+		nvmlCache.AddUpdateHook(sinkManager.OnUpdate)
+		go sinkManager.Run(stop)
+	}
+
 	go nvmlCache.Run(stop)
 
 	go func() {
@@ -85,37 +229,54 @@ func main() {
 		}
 	}()
 
-	// setup collectors
-	procCollector := collector.NewProcessCollector(config, nvmlCache)
-	gpuCollector := collector.NewGPUCollector(config, nvmlCache)
-
-	registry := prometheus.NewRegistry()
-
-	registry.MustRegister(procCollector, gpuCollector)
-
-	// start listening exporter server
-	r := mux.NewRouter()
-	r.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
-	r.PathPrefix("/debug").Handler(debug.HandlerFor(nvmlCache))
-	// r.Handle("/debug", debug.HandlerFor(nvmlCache))
-	server := &http.Server{
-		Addr:    *server_port,
-		Handler: r,
-	}
-	go func() {
-		logrus.Infof("ListenAndServe on port %v", *server_port)
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			logrus.Fatalf("ListenAndServe error: %v", err)
+	var server *http.Server
+	if !*disableHTTP {
+		// start listening exporter server
+		r := mux.NewRouter()
+		r.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		r.PathPrefix("/debug").Handler(debug.HandlerFor(nvmlCache, jobTracker))
+		// r.Handle("/debug", debug.HandlerFor(nvmlCache))
+		server = &http.Server{
+			Addr:    *server_port,
+			Handler: r,
 		}
-	}()
+		go func() {
+			logrus.Infof("ListenAndServe on port %v", *server_port)
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				logrus.Fatalf("ListenAndServe error: %v", err)
+			}
+		}()
+	}
 
 	<-stop
 	// Shut down the server gracefully
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		logrus.Errorf("Server shutdown error: %v", err)
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			logrus.Errorf("Server shutdown error: %v", err)
+		}
+	}
+	// give the remote write client a chance to flush its queue
+	if rwClient != nil {
+		select {
+		case <-rwClient.Done():
+		case <-ctx.Done():
+			logrus.Errorf("Remote write flush timeout")
+		}
+	}
+	if otlpExporter != nil {
+		select {
+		case <-otlpExporter.Done():
+		case <-ctx.Done():
+		}
+	}
+	if sinkManager != nil {
+		select {
+		case <-sinkManager.Done():
+		case <-ctx.Done():
+		}
 	}
 }
 
@@ -126,7 +287,31 @@ func newOSWatcher(sigs ...os.Signal) chan os.Signal {
 	return sigChan
 }
 
-func parseMetricsConfig(filePath string) ([]string, error) {
+// FileConfig is the content of -metric-config-file
+type FileConfig struct {
+	MetricName []string `yaml:"metricName"`
+	// dcgm-exporter counters csv, its fields are added to MetricName
+	DCGMCountersFile string `yaml:"dcgmCountersFile"`
+	dcgmCounters     []collector.DCGMCounter
+	OTLP             otlp.Config `yaml:"otlp"`
+	Sinks            sink.Config `yaml:"sinks"`
+	// relabeling of the exported metrics
+	Labels      *collector.LabelConfig      `yaml:"labels"`
+	Cardinality collector.CardinalityConfig `yaml:"cardinality"`
+	Redaction   *collector.RedactionConfig  `yaml:"redaction"`
+	GPUs        *collector.GPUFilter        `yaml:"gpus"`
+}
+
+func parseMetricsConfig(filePath string) (*FileConfig, error) {
+	// dcgm-exporter counters csv can be used directly
+	if strings.HasSuffix(filePath, ".csv") {
+		config := &FileConfig{DCGMCountersFile: filePath}
+		if err := config.addDCGMCounters(); err != nil {
+			return nil, err
+		}
+		return config, nil
+	}
+
 	// 读取配置文件内容
 	configData, err := ioutil.ReadFile(filePath)
 	if err != nil {
@@ -134,9 +319,7 @@ func parseMetricsConfig(filePath string) ([]string, error) {
 	}
 
 	// 解析配置文件
-	var config struct {
-		MetricName []string `yaml:"metricName"`
-	}
+	var config FileConfig
 	err = yaml.Unmarshal(configData, &config)
 	if err != nil {
 		return nil, fmt.Errorf("parse config file failed：%v", err)
@@ -150,5 +333,51 @@ func parseMetricsConfig(filePath string) ([]string, error) {
 			metrics = append(metrics, name)
 		}
 	}
-	return metrics, nil
+	config.MetricName = metrics
+	if config.Labels != nil {
+		if err := config.Labels.Compile(); err != nil {
+			return nil, fmt.Errorf("invalid labels config, %v", err)
+		}
+	}
+	if config.Redaction != nil {
+		if err := config.Redaction.Compile(); err != nil {
+			return nil, fmt.Errorf("invalid redaction config, %v", err)
+		}
+	}
+	if config.GPUs != nil {
+		if err := config.GPUs.Compile(); err != nil {
+			return nil, fmt.Errorf("invalid gpus config, %v", err)
+		}
+	}
+	if config.DCGMCountersFile != "" {
+		if err := config.addDCGMCounters(); err != nil {
+			return nil, err
+		}
+	}
+	return &config, nil
+}
+
+// addDCGMCounters maps the fields of DCGMCountersFile to NVML metrics, fields
+// NVML cannot provide are reported and skipped
+func (config *FileConfig) addDCGMCounters() error {
+	counters, err := collector.ParseDCGMCounters(config.DCGMCountersFile)
+	if err != nil {
+		return err
+	}
+	metrics, unsupported := collector.DCGMCountersToMetrics(counters)
+	if len(unsupported) > 0 {
+		logrus.Warnf("DCGM fields not supported by NVML, skipped: %v", strings.Join(unsupported, ", "))
+	}
+	config.dcgmCounters = counters
+	seen := make(map[string]bool)
+	for _, name := range config.MetricName {
+		seen[name] = true
+	}
+	for _, name := range metrics {
+		if !seen[name] {
+			config.MetricName = append(config.MetricName, name)
+		}
+	}
+	logrus.Infof("Loaded %d DCGM fields from %v as %d NVML metrics", len(counters)-len(unsupported), config.DCGMCountersFile, len(metrics))
+	return nil
 }
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// procPath honors HOST_PROC like gopsutil, for running inside a container
+func procPath(elem ...string) string {
+	root := os.Getenv("HOST_PROC")
+	if root == "" {
+		root = "/proc"
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// UpdateProcessAffinity reads the cpus and numa nodes the process may run on
+// from /proc/<pid>/status
+func (ps *ProcessStat) UpdateProcessAffinity() error {
+	f, err := os.Open(procPath(fmt.Sprintf("%d", ps.Pid), "status"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Cpus_allowed_list":
+			ps.AllowedCPUs = strings.TrimSpace(value)
+		case "Mems_allowed_list":
+			ps.AllowedNUMANodes = strings.TrimSpace(value)
+		}
+	}
+	return scanner.Err()
+}
+
+// numaMismatch reports whether a process is bound away from the GPU: none of
+// its allowed cpus is local to the GPU, or it may not allocate memory on the
+// GPU's numa node. Unknown affinities are never a mismatch.
+func (g *GPUDevice) numaMismatch(ps *ProcessStat) bool {
+	if ps.AllowedCPUs != "" && g.CPUAffinity != "" {
+		procCPUs, err1 := ParseCPUList(ps.AllowedCPUs)
+		gpuCPUs, err2 := ParseCPUList(g.CPUAffinity)
+		if err1 == nil && err2 == nil && !intersects(procCPUs, gpuCPUs) {
+			return true
+		}
+	}
+	if ps.AllowedNUMANodes != "" && g.NUMANode >= 0 {
+		nodes, err := ParseCPUList(ps.AllowedNUMANodes)
+		if err == nil && !intersects(nodes, []int{g.NUMANode}) {
+			return true
+		}
+	}
+	return false
+}
+
+func intersects(a, b []int) bool {
+	set := make(map[int]struct{}, len(a))
+	for _, v := range a {
+		set[v] = struct{}{}
+	}
+	for _, v := range b {
+		if _, ok := set[v]; ok {
+			return true
+		}
+	}
+	return false
+}
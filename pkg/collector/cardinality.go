@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	AggregateByUser = "user"
+	AggregateByJob  = "job" // requires slurm
+)
+
+const (
+	// exporter metrics of the process series cap
+	PROCESS_SERIES_DROPPED        = "process_series_dropped"        // gauge, process series above maxProcessSeries in the last collect cycle
+	PROCESS_SERIES_OVERFLOW_TOTAL = "process_series_overflow_total" // counter, collect cycles that hit maxProcessSeries
+)
+
+var (
+	ProcessUserLabels = []string{"gpu", "user"}
+	ProcessJobLabels  = []string{"gpu", "slurmJobID", "slurmStepID", "slurmUser", "slurmAccount", "slurmJobName"}
+
+	getProcessUserLabelValues = func(ps ProcessStat) []string {
+		return []string{ps.GPULabel, ps.User}
+	}
+	getProcessJobLabelValues = func(ps ProcessStat) []string {
+		return []string{
+			ps.GPULabel,
+			ps.SlurmJobID,
+			ps.SlurmStepID,
+			ps.SlurmUser,
+			ps.SlurmAccount,
+			ps.SlurmJobName,
+		}
+	}
+)
+
+// CardinalityConfig is the `cardinality` section of the metric config file, it
+// bounds the number of process series. The zero value has no limits.
+type CardinalityConfig struct {
+	// truncate the cmdLine and workDir labels of process_info, 0 is no limit
+	CmdLineMaxLength int `yaml:"cmdLineMaxLength"`
+	// replace the cmdLine label by a hash of the command line
+	CmdLineHash bool `yaml:"cmdLineHash"`
+	// max process series per metric and scrape, the processes using the most
+	// GPU memory are kept, 0 is no limit
+	MaxProcessSeries int `yaml:"maxProcessSeries"`
+	// one series per GPU and user or slurm job instead of per process, values
+	// are summed and process_info counts the processes
+	AggregateBy string `yaml:"aggregateBy"`
+}
+
+func (cc *CardinalityConfig) Validate(useSlurm bool) error {
+	switch cc.AggregateBy {
+	case "", AggregateByUser:
+	case AggregateByJob:
+		if !useSlurm {
+			return fmt.Errorf("aggregateBy: %v requires -use-slurm", cc.AggregateBy)
+		}
+	default:
+		return fmt.Errorf("unknown aggregateBy: %v, expected %v or %v", cc.AggregateBy, AggregateByUser, AggregateByJob)
+	}
+	if cc.CmdLineMaxLength < 0 || cc.MaxProcessSeries < 0 {
+		return fmt.Errorf("cmdLineMaxLength and maxProcessSeries must not be negative")
+	}
+	return nil
+}
+
+// ProcessInfoValues returns the workDir and cmdLine values of a process as
+// exported, truncated or hashed
+func (cc *CardinalityConfig) ProcessInfoValues(ps *ProcessStat) (string, string) {
+	return cc.truncate(ps.WorkingDir), cc.cmdLineLabel(ps.CommandLine)
+}
+
+// cmdLineLabel is the value of the cmdLine label of a command line
+func (cc *CardinalityConfig) cmdLineLabel(cmdLine string) string {
+	if cc.CmdLineHash && cmdLine != "" {
+		sum := sha256.Sum256([]byte(cmdLine))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	return cc.truncate(cmdLine)
+}
+
+// truncate cuts value to at most CmdLineMaxLength bytes on a rune boundary,
+// label values must be valid UTF-8
+func (cc *CardinalityConfig) truncate(value string) string {
+	if cc.CmdLineMaxLength > 0 && len(value) > cc.CmdLineMaxLength {
+		end := cc.CmdLineMaxLength
+		for end > 0 && !utf8.RuneStart(value[end]) {
+			end--
+		}
+		return strings.ToValidUTF8(value[:end], "")
+	}
+	return value
+}
+
+// processGroup is the processes exported as one series per metric, a single
+// process unless aggregated
+type processGroup struct {
+	labelValues []string
+	processes   []ProcessStat
+	gpuMemory   uint64
+}
+
+func (g *processGroup) value(metricName string) float64 {
+	value := 0.0
+	for i := range g.processes {
+		value += g.processes[i].GetValueFromMetricName(metricName)
+	}
+	return value
+}
+
+// groupProcesses groups the processes into series, capped at MaxProcessSeries,
+// and returns the number of groups dropped by the cap
+func (c *ProcessCollector) groupProcesses(processCache map[string]ProcessStat) ([]*processGroup, int) {
+	groups := make([]*processGroup, 0, len(processCache))
+	byKey := make(map[string]*processGroup)
+	for _, ps := range processCache {
+		labelValues := c.funcGetLabelValues(ps)
+		key := strings.Join(labelValues, "\x00")
+		g, ok := byKey[key]
+		if !ok || c.config.Cardinality.AggregateBy == "" {
+			g = &processGroup{labelValues: labelValues}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.processes = append(g.processes, ps)
+		g.gpuMemory += ps.GPUUsedMemoryBytes
+	}
+	max := c.config.Cardinality.MaxProcessSeries
+	if max <= 0 || len(groups) <= max {
+		return groups, 0
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].gpuMemory != groups[j].gpuMemory {
+			return groups[i].gpuMemory > groups[j].gpuMemory
+		}
+		return strings.Join(groups[i].labelValues, "\x00") < strings.Join(groups[j].labelValues, "\x00")
+	})
+	return groups[:max], len(groups) - max
+}
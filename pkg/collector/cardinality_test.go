@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestCmdLineLabel(t *testing.T) {
+	tests := []struct {
+		config CardinalityConfig
+		value  string
+		want   string
+	}{
+		{CardinalityConfig{}, "python train.py", "python train.py"},
+		{CardinalityConfig{CmdLineMaxLength: 6}, "python train.py", "python"},
+		// é is 2 bytes, the cut falls inside it
+		{CardinalityConfig{CmdLineMaxLength: 5}, "pythé train.py", "pyth"},
+		{CardinalityConfig{CmdLineHash: true}, "", ""},
+	}
+	for _, tt := range tests {
+		got := tt.config.cmdLineLabel(tt.value)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("cmdLineLabel(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	hashed := &CardinalityConfig{CmdLineMaxLength: 6, CmdLineHash: true}
+	a, b := hashed.cmdLineLabel("python a.py"), hashed.cmdLineLabel("python b.py")
+	if !strings.HasPrefix(a, "sha256:") || len(a) != len("sha256:")+16 || a == b {
+		t.Errorf("hashed cmdLine labels %q and %q", a, b)
+	}
+}
+
+func TestProcessSeriesOverflow(t *testing.T) {
+	config := &Config{HostName: "node1", Cardinality: CardinalityConfig{MaxProcessSeries: 1}}
+	cache := &NVMLCache{config: config, ProcessStats: make(map[string]ProcessStat), LastUpdate: time.Unix(1700000000, 0)}
+	for pid := uint32(1); pid <= 3; pid++ {
+		cache.ProcessStats[fmt.Sprintf("%d", pid)] = ProcessStat{Pid: pid, GPULabel: "0", GPUUsedMemoryBytes: uint64(pid)}
+	}
+	c := NewProcessCollector(config, cache)
+
+	// textfile, remote write and /metrics gather the same update
+	for i := 0; i < 3; i++ {
+		if got := gatherValues(t, c)[PROCESS_SERIES_OVERFLOW_TOTAL]; got != 1 {
+			t.Errorf("gather %d: %v overflows, want 1", i, got)
+		}
+	}
+	cache.LastUpdate = cache.LastUpdate.Add(5 * time.Second)
+	values := gatherValues(t, c)
+	if values[PROCESS_SERIES_OVERFLOW_TOTAL] != 2 {
+		t.Errorf("%v overflows after the next update, want 2", values[PROCESS_SERIES_OVERFLOW_TOTAL])
+	}
+	if want := float64(2 * len(SupportedProcessMetricsName)); values[PROCESS_SERIES_DROPPED] != want {
+		t.Errorf("%v series dropped, want %v", values[PROCESS_SERIES_DROPPED], want)
+	}
+}
@@ -20,27 +20,113 @@ func ISProcessMetricName(name string) bool {
 	return strings.HasPrefix(name, "process_")
 }
 
+// IsGPUInfoMetric reports whether a GPU metric has the value 1 and carries
+// static GPUInfo in its labels
+func IsGPUInfoMetric(name string) bool {
+	return name == GPU_INFO || name == GPU_NUMA_INFO || name == GPU_TOPOLOGY_INFO
+}
+
+// IsGPUHealthMetric reports whether a GPU metric is exported while the GPU is down
+func IsGPUHealthMetric(name string) bool {
+	return name == GPU_UP || name == GPU_DOWN_INFO
+}
+
+// HasExtraLabels reports whether a GPU metric has one series per value of
+// METRIC_EXTRA_LABELS instead of one series per GPU
+func HasExtraLabels(name string) bool {
+	_, ok := METRIC_EXTRA_LABELS[name]
+	return ok
+}
+
+// Metric naming schemes, see Config.Naming
+const (
+	NamingLegacy = "legacy"
+	NamingV2     = "v2"   // METRIC_V2_META_MAP
+	NamingBoth   = "both" // legacy and v2 names, while migrating
+	NamingDCGM   = "dcgm" // metric names and labels of dcgm-exporter
+)
+
+// Sources of the gpu label, see Config.GPULabel. The nvml index follows the
+// enumeration order, which may change across driver loads and differ from
+// CUDA_VISIBLE_DEVICES, the minor number and pci bus id are stable.
+const (
+	GPULabelIndex    = "index"    // nvml index, as nvidia-smi
+	GPULabelMinor    = "minor"    // N of /dev/nvidiaN, as slurm gres
+	GPULabelPCIBusID = "pciBusID" // e.g. 00000000:3B:00.0
+	GPULabelUUID     = "uuid"
+)
+
+const (
+	LabelClockDomain = "domain"
+	LabelDevice      = "device"
+	LabelFan         = "fan"
+	LabelSource      = "source" // dcgm or nvml, for profiling metrics
+	LabelReason      = "reason" // why a GPU is down, e.g. GPU_IS_LOST
+)
+
 const (
 	// MetricName
 
 	// GPU
+	GPU_INFO          = "gpu_info"          // gauge, GPU static information in labels, value is always 1.
+	GPU_NUMA_INFO     = "gpu_numa_info"     // gauge, NUMA node and CPU affinity of the GPU in labels, value is always 1.
+	GPU_TOPOLOGY_INFO = "gpu_topology_info" // gauge, Link type to every peer GPU in labels, value is always 1.
+	GPU_UP            = "gpu_up"            // gauge, 1 if the GPU can be queried, 0 otherwise.
+	GPU_DOWN_INFO     = "gpu_down_info"     // gauge, Why the GPU cannot be queried in the reason label, value is always 1, only while the GPU is down.
+
 	// Clocks
 	GPU_SM_CLOCK     = "gpu_sm_clock"     //     gauge, SM clock frequency (in MHz).
 	GPU_MEMORY_CLOCK = "gpu_memory_clock" //gauge, Memory clock frequency (in MHz).
 
+	// Clocks per domain, label domain: graphics, sm, memory, video
+	GPU_CLOCK_CURRENT             = "gpu_clock_current"             // gauge, Current clock (in MHz).
+	GPU_CLOCK_MAX                 = "gpu_clock_max"                 // gauge, Max clock (in MHz).
+	GPU_CLOCK_APPLICATION         = "gpu_clock_application"         // gauge, Target application clock (in MHz).
+	GPU_CLOCK_DEFAULT_APPLICATION = "gpu_clock_default_application" // gauge, Default application clock (in MHz).
+	GPU_CLOCK_BOOST_MAX           = "gpu_clock_boost_max"           // gauge, OEM defined max boost clock (in MHz).
+	GPU_CLOCK_PSTATE_MIN          = "gpu_clock_pstate_min"          // gauge, Min clock of the current P-state (in MHz).
+	GPU_CLOCK_PSTATE_MAX          = "gpu_clock_pstate_max"          // gauge, Max clock of the current P-state (in MHz).
+	GPU_CLOCK_VF_OFFSET           = "gpu_clock_vf_offset"           // gauge, Clock offset of the V/F curve, graphics and memory only (in MHz).
+	GPU_CLOCK_VF_OFFSET_MIN       = "gpu_clock_vf_offset_min"       // gauge, Min settable clock offset (in MHz).
+	GPU_CLOCK_VF_OFFSET_MAX       = "gpu_clock_vf_offset_max"       // gauge, Max settable clock offset (in MHz).
+
 	// Temperature
-	GPU_TEMPERATURE = "gpu_temperature" //   gauge, GPU temperature (in C).
+	GPU_TEMPERATURE                    = "gpu_temperature"                    //   gauge, GPU temperature (in C).
+	GPU_MEMORY_TEMPERATURE             = "gpu_memory_temperature"             // gauge, HBM memory temperature (in C).
+	GPU_TEMPERATURE_SLOWDOWN_THRESHOLD = "gpu_temperature_slowdown_threshold" // gauge, Temperature at which the GPU slows down (in C).
+	GPU_TEMPERATURE_SHUTDOWN_THRESHOLD = "gpu_temperature_shutdown_threshold" // gauge, Temperature at which the GPU shuts down (in C).
 
 	// FAN
-	GPU_FAN_SPEED = "gpu_fan_speed" // gauge, Fan speed (in %).
+	GPU_FAN_SPEED          = "gpu_fan_speed"          // gauge, Fan speed (in %).
+	GPU_FAN_TARGET_SPEED   = "gpu_fan_target_speed"   // gauge, Fan speed the driver aims for (in %).
+	GPU_FAN_CONTROL_POLICY = "gpu_fan_control_policy" // gauge, 0 if the fan is controlled by the driver, 1 if set manually.
 
 	// Power
 	GPU_POWER_USAGE              = "gpu_power_usage"              //              gauge, Power draw (in W).
 	GPU_TOTAL_ENERGY_CONSUMPTION = "gpu_total_energy_consumption" // counter, Total energy consumption since boot (in mJ).
+	GPU_POWER_LIMIT              = "gpu_power_limit"              // gauge, Enforced power limit (in W).
+	GPU_POWER_DEFAULT_LIMIT      = "gpu_power_default_limit"      // gauge, Default power management limit (in W).
+	GPU_POWER_MIN_LIMIT          = "gpu_power_min_limit"          // gauge, Minimum settable power management limit (in W).
+	GPU_POWER_MAX_LIMIT          = "gpu_power_max_limit"          // gauge, Maximum settable power management limit (in W).
+	GPU_POWER_MANAGEMENT_MODE    = "gpu_power_management_mode"    // gauge, 1 if power management is enabled.
+	GPU_POWER_STATE              = "gpu_power_state"              // gauge, Performance state P0-P15, -1 if unknown.
 
 	// PCIe
-	GPU_PCIE_TX_BYTES = "gpu_pcie_tx_bytes" //  counter, Total number of bytes transmitted through PCIe TX via NVML.
-	GPU_PCIE_RX_BYTES = "gpu_pcie_rx_bytes" //counter, Total number of bytes received through PCIe RX via NVML.
+	GPU_PCIE_TX_BYTES_PER_SECOND = "gpu_pcie_tx_bytes_per_second" // gauge, PCIe TX throughput sampled over 20ms (in B/s).
+	GPU_PCIE_RX_BYTES_PER_SECOND = "gpu_pcie_rx_bytes_per_second" // gauge, PCIe RX throughput sampled over 20ms (in B/s).
+	GPU_PCIE_TX_BYTES_TOTAL      = "gpu_pcie_tx_bytes_total"      // counter, PCIe TX bytes integrated from throughput samples.
+	GPU_PCIE_RX_BYTES_TOTAL      = "gpu_pcie_rx_bytes_total"      // counter, PCIe RX bytes integrated from throughput samples.
+	// Deprecated: same value as GPU_PCIE_TX/RX_BYTES_PER_SECOND, kept for existing dashboards
+	GPU_PCIE_TX_BYTES = "gpu_pcie_tx_bytes" // gauge, PCIe TX throughput (in B/s).
+	GPU_PCIE_RX_BYTES = "gpu_pcie_rx_bytes" // gauge, PCIe RX throughput (in B/s).
+
+	// PCIe link
+	GPU_PCIE_LINK_GEN_CURRENT   = "gpu_pcie_link_gen_current"   // gauge, Current PCIe link generation.
+	GPU_PCIE_LINK_GEN_MAX       = "gpu_pcie_link_gen_max"       // gauge, Max PCIe link generation of the GPU and system.
+	GPU_PCIE_LINK_WIDTH_CURRENT = "gpu_pcie_link_width_current" // gauge, Current PCIe link width (lanes).
+	GPU_PCIE_LINK_WIDTH_MAX     = "gpu_pcie_link_width_max"     // gauge, Max PCIe link width (lanes).
+	GPU_PCIE_REPLAY_COUNTER     = "gpu_pcie_replay_counter"     // counter, PCIe replay counter.
+	GPU_PCIE_LINK_DEGRADED      = "gpu_pcie_link_degraded"      // gauge, 1 if the link runs below max width while the GPU is busy.
 
 	// NvLink
 	// GPU_NVLINK_TX_BYTES = "gpu_nvlink_tx_bytes"
@@ -52,20 +138,49 @@ const (
 	GPU_ENC_UTILIZATION      = "gpu_enc_utilization"      //    gauge, Encoder utilization (in %).
 	GPU_DEC_UTILIZATION      = "gpu_dec_utilization"      // gauge, Decoder utilization (in %).
 
+	// Encoder and frame buffer capture sessions
+	GPU_ENCODER_SESSION_COUNT   = "gpu_encoder_session_count"   // gauge, Number of active encoder sessions.
+	GPU_ENCODER_AVERAGE_FPS     = "gpu_encoder_average_fps"     // gauge, Average FPS of all encoder sessions.
+	GPU_ENCODER_AVERAGE_LATENCY = "gpu_encoder_average_latency" // gauge, Average latency of all encoder sessions (in us).
+	GPU_FBC_SESSION_COUNT       = "gpu_fbc_session_count"       // gauge, Number of active frame buffer capture sessions.
+	GPU_FBC_AVERAGE_FPS         = "gpu_fbc_average_fps"         // gauge, Average FPS of all FBC sessions.
+	GPU_FBC_AVERAGE_LATENCY     = "gpu_fbc_average_latency"     // gauge, Average latency of all FBC sessions (in us).
+
+	// Profiling, from a DCGM host engine or estimated from NVML
+	GPU_PROF_GR_ENGINE_ACTIVE = "gpu_prof_gr_engine_active" // gauge, Ratio of time the graphics engine is active (0-1).
+	GPU_PROF_SM_ACTIVE        = "gpu_prof_sm_active"        // gauge, Ratio of cycles an SM has at least 1 warp assigned (0-1).
+	GPU_PROF_SM_OCCUPANCY     = "gpu_prof_sm_occupancy"     // gauge, Ratio of warps resident on an SM to the max (0-1).
+	GPU_PROF_TENSOR_ACTIVE    = "gpu_prof_tensor_active"    // gauge, Ratio of cycles the tensor pipe is active (0-1).
+	GPU_PROF_DRAM_ACTIVE      = "gpu_prof_dram_active"      // gauge, Ratio of cycles the memory interface is active (0-1).
+	GPU_PROF_FP64_ACTIVE      = "gpu_prof_fp64_active"      // gauge, Ratio of cycles the fp64 pipe is active (0-1).
+	GPU_PROF_FP32_ACTIVE      = "gpu_prof_fp32_active"      // gauge, Ratio of cycles the fp32 pipe is active (0-1).
+	GPU_PROF_FP16_ACTIVE      = "gpu_prof_fp16_active"      // gauge, Ratio of cycles the fp16 pipe is active (0-1).
+	GPU_PROF_PCIE_TX_BYTES    = "gpu_prof_pcie_tx_bytes"    // gauge, PCIe TX rate including headers (in B/s).
+	GPU_PROF_PCIE_RX_BYTES    = "gpu_prof_pcie_rx_bytes"    // gauge, PCIe RX rate including headers (in B/s).
+	GPU_PROF_NVLINK_TX_BYTES  = "gpu_prof_nvlink_tx_bytes"  // gauge, NVLink TX rate (in B/s).
+	GPU_PROF_NVLINK_RX_BYTES  = "gpu_prof_nvlink_rx_bytes"  // gauge, NVLink RX rate (in B/s).
+
 	// Memory usage
-	GPU_MEMORY_FREE_BYTES = "gpu_memory_free_bytes"
-	GPU_MEMORY_USED_BYTES = "gpu_memory_used_bytes"
+	GPU_MEMORY_FREE_BYTES     = "gpu_memory_free_bytes"
+	GPU_MEMORY_USED_BYTES     = "gpu_memory_used_bytes"
+	GPU_MEMORY_TOTAL_BYTES    = "gpu_memory_total_bytes"
+	GPU_MEMORY_RESERVED_BYTES = "gpu_memory_reserved_bytes" // memory reserved by the driver and firmware
+	GPU_BAR1_TOTAL_BYTES      = "gpu_bar1_total_bytes"
+	GPU_BAR1_USED_BYTES       = "gpu_bar1_used_bytes"
+	GPU_BAR1_FREE_BYTES       = "gpu_bar1_free_bytes"
 
 	// Process
-	PROCESS_INFO               = "process_info"
-	PROCESS_CPU_PERCENT        = "process_cpu_precent"
-	PROCESS_CPU_MEM_USED_BYTES = "process_cpu_mem_used_bytes"
-	PROCESS_NUM_THREADS        = "process_num_threads"
-	PROCESS_GPU_SM_UTIL        = "process_gpu_sm_util"
-	PROCESS_GPU_MEM_UTIL       = "process_gpu_mem_util"
-	PROCESS_GPU_DECODE_UTIL    = "process_gpu_decode_util"
-	PROCESS_GPU_ENCODE_UTIL    = "process_gpu_encode_util"
-	PROCESS_GPU_MEM_USED_BYTES = "process_gpu_mem_used_bytes"
+	PROCESS_INFO                 = "process_info"
+	PROCESS_CPU_PERCENT          = "process_cpu_precent"
+	PROCESS_CPU_MEM_USED_BYTES   = "process_cpu_mem_used_bytes"
+	PROCESS_NUM_THREADS          = "process_num_threads"
+	PROCESS_GPU_SM_UTIL          = "process_gpu_sm_util"
+	PROCESS_GPU_MEM_UTIL         = "process_gpu_mem_util"
+	PROCESS_GPU_DECODE_UTIL      = "process_gpu_decode_util"
+	PROCESS_GPU_ENCODE_UTIL      = "process_gpu_encode_util"
+	PROCESS_GPU_MEM_USED_BYTES   = "process_gpu_mem_used_bytes"
+	PROCESS_GPU_ENCODER_SESSIONS = "process_gpu_encoder_sessions"
+	PROCESS_GPU_NUMA_MISMATCH    = "process_gpu_numa_mismatch" // 1 if the process is bound to cpus or numa nodes away from its GPU
 
 	// PROCESS_GPU_FRAME_MEM_UTIL = "process_gpu_frame_mem_util"
 	// PROCESS_GPU_MEM_USED       = "process_gpu_mem_used"
@@ -74,28 +189,222 @@ const (
 var (
 	// todo: add specific help info of process info
 	METRIC_META_MAP = map[string]MetricMeta{
-		GPU_SM_CLOCK:                 {GPU_SM_CLOCK, prometheus.GaugeValue, "SM clock frequency (in MHz)."},
-		GPU_MEMORY_CLOCK:             {GPU_MEMORY_CLOCK, prometheus.GaugeValue, "Memory clock frequency (in MHz)."},
-		GPU_TEMPERATURE:              {GPU_TEMPERATURE, prometheus.GaugeValue, "GPU temperature (in C)."},
-		GPU_FAN_SPEED:                {GPU_FAN_SPEED, prometheus.GaugeValue, "Fan speed (in %)."},
-		GPU_POWER_USAGE:              {GPU_POWER_USAGE, prometheus.GaugeValue, "Power draw (in W)."},
-		GPU_TOTAL_ENERGY_CONSUMPTION: {GPU_TOTAL_ENERGY_CONSUMPTION, prometheus.CounterValue, "Total energy consumption since boot (in mJ)."},
-		GPU_PCIE_TX_BYTES:            {GPU_PCIE_TX_BYTES, prometheus.GaugeValue, "Total number of bytes transmitted through PCIe TX via NVML."},
-		GPU_PCIE_RX_BYTES:            {GPU_PCIE_RX_BYTES, prometheus.GaugeValue, "Total number of bytes received through PCIe RX via NVML."},
-		GPU_UTILIZATION:              {GPU_UTILIZATION, prometheus.GaugeValue, "GPU utilization (in %)."},
-		GPU_MEM_COPY_UTILIZATION:     {GPU_MEM_COPY_UTILIZATION, prometheus.GaugeValue, "Memory utilization (in %)."},
-		GPU_ENC_UTILIZATION:          {GPU_ENC_UTILIZATION, prometheus.GaugeValue, "Encoder utilization (in %)."},
-		GPU_DEC_UTILIZATION:          {GPU_DEC_UTILIZATION, prometheus.GaugeValue, "Decoder utilization (in %)."},
-		GPU_MEMORY_FREE_BYTES:        {GPU_MEMORY_FREE_BYTES, prometheus.GaugeValue, "Framebuffer memory free bytes."},
-		GPU_MEMORY_USED_BYTES:        {GPU_MEMORY_USED_BYTES, prometheus.GaugeValue, "Framebuffer memory used bytes."},
-		PROCESS_INFO:                 {PROCESS_INFO, prometheus.GaugeValue, "Process info."},
-		PROCESS_CPU_PERCENT:          {PROCESS_CPU_PERCENT, prometheus.GaugeValue, "Process CPU percent."},
-		PROCESS_CPU_MEM_USED_BYTES:   {PROCESS_CPU_MEM_USED_BYTES, prometheus.GaugeValue, "Process CPU memory used bytes."},
-		PROCESS_NUM_THREADS:          {PROCESS_NUM_THREADS, prometheus.GaugeValue, "Process num threads."},
-		PROCESS_GPU_SM_UTIL:          {PROCESS_GPU_SM_UTIL, prometheus.GaugeValue, "Process GPU SM util (in %)."},
-		PROCESS_GPU_MEM_UTIL:         {PROCESS_GPU_MEM_UTIL, prometheus.GaugeValue, "Process GPU memory util (in %)."},
-		PROCESS_GPU_DECODE_UTIL:      {PROCESS_GPU_DECODE_UTIL, prometheus.GaugeValue, "Process GPU decode util (in %)."},
-		PROCESS_GPU_ENCODE_UTIL:      {PROCESS_GPU_ENCODE_UTIL, prometheus.GaugeValue, "Process GPU encode util (in %)."},
-		PROCESS_GPU_MEM_USED_BYTES:   {PROCESS_GPU_MEM_USED_BYTES, prometheus.GaugeValue, "Process GPU memory used bytes."},
+		GPU_INFO:                           {GPU_INFO, prometheus.GaugeValue, "GPU info, driver and board details in labels."},
+		GPU_NUMA_INFO:                      {GPU_NUMA_INFO, prometheus.GaugeValue, "GPU NUMA node and CPU affinity in labels."},
+		GPU_TOPOLOGY_INFO:                  {GPU_TOPOLOGY_INFO, prometheus.GaugeValue, "GPU to GPU link type in labels, as in nvidia-smi topo -m."},
+		GPU_UP:                             {GPU_UP, prometheus.GaugeValue, "1 if the GPU can be queried, 0 otherwise."},
+		GPU_DOWN_INFO:                      {GPU_DOWN_INFO, prometheus.GaugeValue, "Why the GPU cannot be queried in the reason label, only while it is down."},
+		GPU_SM_CLOCK:                       {GPU_SM_CLOCK, prometheus.GaugeValue, "SM clock frequency (in MHz)."},
+		GPU_MEMORY_CLOCK:                   {GPU_MEMORY_CLOCK, prometheus.GaugeValue, "Memory clock frequency (in MHz)."},
+		GPU_CLOCK_CURRENT:                  {GPU_CLOCK_CURRENT, prometheus.GaugeValue, "Current clock frequency per domain (in MHz)."},
+		GPU_CLOCK_MAX:                      {GPU_CLOCK_MAX, prometheus.GaugeValue, "Max clock frequency per domain (in MHz)."},
+		GPU_CLOCK_APPLICATION:              {GPU_CLOCK_APPLICATION, prometheus.GaugeValue, "Target application clock frequency per domain (in MHz)."},
+		GPU_CLOCK_DEFAULT_APPLICATION:      {GPU_CLOCK_DEFAULT_APPLICATION, prometheus.GaugeValue, "Default application clock frequency per domain (in MHz)."},
+		GPU_CLOCK_BOOST_MAX:                {GPU_CLOCK_BOOST_MAX, prometheus.GaugeValue, "OEM defined max boost clock frequency per domain (in MHz)."},
+		GPU_CLOCK_PSTATE_MIN:               {GPU_CLOCK_PSTATE_MIN, prometheus.GaugeValue, "Min clock frequency of the current P-state per domain (in MHz)."},
+		GPU_CLOCK_PSTATE_MAX:               {GPU_CLOCK_PSTATE_MAX, prometheus.GaugeValue, "Max clock frequency of the current P-state per domain (in MHz)."},
+		GPU_CLOCK_VF_OFFSET:                {GPU_CLOCK_VF_OFFSET, prometheus.GaugeValue, "Clock offset of the voltage/frequency curve per domain (in MHz)."},
+		GPU_CLOCK_VF_OFFSET_MIN:            {GPU_CLOCK_VF_OFFSET_MIN, prometheus.GaugeValue, "Min settable clock offset of the voltage/frequency curve per domain (in MHz)."},
+		GPU_CLOCK_VF_OFFSET_MAX:            {GPU_CLOCK_VF_OFFSET_MAX, prometheus.GaugeValue, "Max settable clock offset of the voltage/frequency curve per domain (in MHz)."},
+		GPU_TEMPERATURE:                    {GPU_TEMPERATURE, prometheus.GaugeValue, "GPU temperature (in C)."},
+		GPU_MEMORY_TEMPERATURE:             {GPU_MEMORY_TEMPERATURE, prometheus.GaugeValue, "HBM memory temperature (in C)."},
+		GPU_TEMPERATURE_SLOWDOWN_THRESHOLD: {GPU_TEMPERATURE_SLOWDOWN_THRESHOLD, prometheus.GaugeValue, "Temperature at which the GPU slows down (in C)."},
+		GPU_TEMPERATURE_SHUTDOWN_THRESHOLD: {GPU_TEMPERATURE_SHUTDOWN_THRESHOLD, prometheus.GaugeValue, "Temperature at which the GPU shuts down (in C)."},
+		GPU_FAN_SPEED:                      {GPU_FAN_SPEED, prometheus.GaugeValue, "Fan speed (in %)."},
+		GPU_FAN_TARGET_SPEED:               {GPU_FAN_TARGET_SPEED, prometheus.GaugeValue, "Fan speed the driver aims for (in %)."},
+		GPU_FAN_CONTROL_POLICY:             {GPU_FAN_CONTROL_POLICY, prometheus.GaugeValue, "Fan control policy, 0 if controlled by the driver, 1 if set manually."},
+		GPU_POWER_USAGE:                    {GPU_POWER_USAGE, prometheus.GaugeValue, "Power draw (in W)."},
+		GPU_TOTAL_ENERGY_CONSUMPTION:       {GPU_TOTAL_ENERGY_CONSUMPTION, prometheus.CounterValue, "Total energy consumption since boot (in mJ)."},
+		GPU_POWER_LIMIT:                    {GPU_POWER_LIMIT, prometheus.GaugeValue, "Enforced power limit (in W)."},
+		GPU_POWER_DEFAULT_LIMIT:            {GPU_POWER_DEFAULT_LIMIT, prometheus.GaugeValue, "Default power management limit (in W)."},
+		GPU_POWER_MIN_LIMIT:                {GPU_POWER_MIN_LIMIT, prometheus.GaugeValue, "Minimum settable power management limit (in W)."},
+		GPU_POWER_MAX_LIMIT:                {GPU_POWER_MAX_LIMIT, prometheus.GaugeValue, "Maximum settable power management limit (in W)."},
+		GPU_POWER_MANAGEMENT_MODE:          {GPU_POWER_MANAGEMENT_MODE, prometheus.GaugeValue, "Power management mode, 1 if enabled."},
+		GPU_POWER_STATE:                    {GPU_POWER_STATE, prometheus.GaugeValue, "Performance state (P-state) 0-15, -1 if unknown."},
+		GPU_PCIE_TX_BYTES_PER_SECOND:       {GPU_PCIE_TX_BYTES_PER_SECOND, prometheus.GaugeValue, "PCIe TX throughput sampled over 20ms (in B/s)."},
+		GPU_PCIE_RX_BYTES_PER_SECOND:       {GPU_PCIE_RX_BYTES_PER_SECOND, prometheus.GaugeValue, "PCIe RX throughput sampled over 20ms (in B/s)."},
+		GPU_PCIE_TX_BYTES_TOTAL:            {GPU_PCIE_TX_BYTES_TOTAL, prometheus.CounterValue, "Total PCIe TX bytes since exporter start, integrated from throughput samples."},
+		GPU_PCIE_RX_BYTES_TOTAL:            {GPU_PCIE_RX_BYTES_TOTAL, prometheus.CounterValue, "Total PCIe RX bytes since exporter start, integrated from throughput samples."},
+		GPU_PCIE_TX_BYTES:                  {GPU_PCIE_TX_BYTES, prometheus.GaugeValue, "Deprecated, use gpu_pcie_tx_bytes_per_second. PCIe TX throughput (in B/s)."},
+		GPU_PCIE_RX_BYTES:                  {GPU_PCIE_RX_BYTES, prometheus.GaugeValue, "Deprecated, use gpu_pcie_rx_bytes_per_second. PCIe RX throughput (in B/s)."},
+		GPU_PCIE_LINK_GEN_CURRENT:          {GPU_PCIE_LINK_GEN_CURRENT, prometheus.GaugeValue, "Current PCIe link generation."},
+		GPU_PCIE_LINK_GEN_MAX:              {GPU_PCIE_LINK_GEN_MAX, prometheus.GaugeValue, "Max PCIe link generation supported by the GPU and system."},
+		GPU_PCIE_LINK_WIDTH_CURRENT:        {GPU_PCIE_LINK_WIDTH_CURRENT, prometheus.GaugeValue, "Current PCIe link width (in lanes)."},
+		GPU_PCIE_LINK_WIDTH_MAX:            {GPU_PCIE_LINK_WIDTH_MAX, prometheus.GaugeValue, "Max PCIe link width (in lanes)."},
+		GPU_PCIE_REPLAY_COUNTER:            {GPU_PCIE_REPLAY_COUNTER, prometheus.CounterValue, "PCIe replay counter."},
+		GPU_PCIE_LINK_DEGRADED:             {GPU_PCIE_LINK_DEGRADED, prometheus.GaugeValue, "1 if the PCIe link runs below its max width while the GPU is busy."},
+		GPU_UTILIZATION:                    {GPU_UTILIZATION, prometheus.GaugeValue, "GPU utilization (in %)."},
+		GPU_MEM_COPY_UTILIZATION:           {GPU_MEM_COPY_UTILIZATION, prometheus.GaugeValue, "Memory utilization (in %)."},
+		GPU_ENC_UTILIZATION:                {GPU_ENC_UTILIZATION, prometheus.GaugeValue, "Encoder utilization (in %)."},
+		GPU_DEC_UTILIZATION:                {GPU_DEC_UTILIZATION, prometheus.GaugeValue, "Decoder utilization (in %)."},
+		GPU_ENCODER_SESSION_COUNT:          {GPU_ENCODER_SESSION_COUNT, prometheus.GaugeValue, "Number of active encoder sessions."},
+		GPU_ENCODER_AVERAGE_FPS:            {GPU_ENCODER_AVERAGE_FPS, prometheus.GaugeValue, "Average FPS of all encoder sessions."},
+		GPU_ENCODER_AVERAGE_LATENCY:        {GPU_ENCODER_AVERAGE_LATENCY, prometheus.GaugeValue, "Average latency of all encoder sessions (in us)."},
+		GPU_FBC_SESSION_COUNT:              {GPU_FBC_SESSION_COUNT, prometheus.GaugeValue, "Number of active frame buffer capture sessions."},
+		GPU_FBC_AVERAGE_FPS:                {GPU_FBC_AVERAGE_FPS, prometheus.GaugeValue, "Average FPS of all frame buffer capture sessions."},
+		GPU_FBC_AVERAGE_LATENCY:            {GPU_FBC_AVERAGE_LATENCY, prometheus.GaugeValue, "Average latency of all frame buffer capture sessions (in us)."},
+		GPU_PROF_GR_ENGINE_ACTIVE:          {GPU_PROF_GR_ENGINE_ACTIVE, prometheus.GaugeValue, "Ratio of time the graphics engine is active (0-1)."},
+		GPU_PROF_SM_ACTIVE:                 {GPU_PROF_SM_ACTIVE, prometheus.GaugeValue, "Ratio of cycles an SM has at least 1 warp assigned (0-1)."},
+		GPU_PROF_SM_OCCUPANCY:              {GPU_PROF_SM_OCCUPANCY, prometheus.GaugeValue, "Ratio of number of warps resident on an SM to the max (0-1)."},
+		GPU_PROF_TENSOR_ACTIVE:             {GPU_PROF_TENSOR_ACTIVE, prometheus.GaugeValue, "Ratio of cycles the tensor (HMMA) pipe is active (0-1)."},
+		GPU_PROF_DRAM_ACTIVE:               {GPU_PROF_DRAM_ACTIVE, prometheus.GaugeValue, "Ratio of cycles the device memory interface is active sending or receiving data (0-1)."},
+		GPU_PROF_FP64_ACTIVE:               {GPU_PROF_FP64_ACTIVE, prometheus.GaugeValue, "Ratio of cycles the fp64 pipe is active (0-1)."},
+		GPU_PROF_FP32_ACTIVE:               {GPU_PROF_FP32_ACTIVE, prometheus.GaugeValue, "Ratio of cycles the fp32 pipe is active (0-1)."},
+		GPU_PROF_FP16_ACTIVE:               {GPU_PROF_FP16_ACTIVE, prometheus.GaugeValue, "Ratio of cycles the fp16 pipe is active (0-1)."},
+		GPU_PROF_PCIE_TX_BYTES:             {GPU_PROF_PCIE_TX_BYTES, prometheus.GaugeValue, "The rate of data transmitted over the PCIe bus, including headers (in B/s)."},
+		GPU_PROF_PCIE_RX_BYTES:             {GPU_PROF_PCIE_RX_BYTES, prometheus.GaugeValue, "The rate of data received over the PCIe bus, including headers (in B/s)."},
+		GPU_PROF_NVLINK_TX_BYTES:           {GPU_PROF_NVLINK_TX_BYTES, prometheus.GaugeValue, "The rate of data transmitted over NVLink (in B/s)."},
+		GPU_PROF_NVLINK_RX_BYTES:           {GPU_PROF_NVLINK_RX_BYTES, prometheus.GaugeValue, "The rate of data received over NVLink (in B/s)."},
+		GPU_MEMORY_FREE_BYTES:              {GPU_MEMORY_FREE_BYTES, prometheus.GaugeValue, "Framebuffer memory free bytes."},
+		GPU_MEMORY_USED_BYTES:              {GPU_MEMORY_USED_BYTES, prometheus.GaugeValue, "Framebuffer memory used bytes."},
+		GPU_MEMORY_TOTAL_BYTES:             {GPU_MEMORY_TOTAL_BYTES, prometheus.GaugeValue, "Framebuffer memory total bytes."},
+		GPU_MEMORY_RESERVED_BYTES:          {GPU_MEMORY_RESERVED_BYTES, prometheus.GaugeValue, "Framebuffer memory reserved by the driver and firmware bytes."},
+		GPU_BAR1_TOTAL_BYTES:               {GPU_BAR1_TOTAL_BYTES, prometheus.GaugeValue, "BAR1 memory total bytes."},
+		GPU_BAR1_USED_BYTES:                {GPU_BAR1_USED_BYTES, prometheus.GaugeValue, "BAR1 memory used bytes."},
+		GPU_BAR1_FREE_BYTES:                {GPU_BAR1_FREE_BYTES, prometheus.GaugeValue, "BAR1 memory free bytes."},
+		PROCESS_INFO:                       {PROCESS_INFO, prometheus.GaugeValue, "Process info."},
+		PROCESS_CPU_PERCENT:                {PROCESS_CPU_PERCENT, prometheus.GaugeValue, "Process CPU percent."},
+		PROCESS_CPU_MEM_USED_BYTES:         {PROCESS_CPU_MEM_USED_BYTES, prometheus.GaugeValue, "Process CPU memory used bytes."},
+		PROCESS_NUM_THREADS:                {PROCESS_NUM_THREADS, prometheus.GaugeValue, "Process num threads."},
+		PROCESS_GPU_SM_UTIL:                {PROCESS_GPU_SM_UTIL, prometheus.GaugeValue, "Process GPU SM util (in %)."},
+		PROCESS_GPU_MEM_UTIL:               {PROCESS_GPU_MEM_UTIL, prometheus.GaugeValue, "Process GPU memory util (in %)."},
+		PROCESS_GPU_DECODE_UTIL:            {PROCESS_GPU_DECODE_UTIL, prometheus.GaugeValue, "Process GPU decode util (in %)."},
+		PROCESS_GPU_ENCODE_UTIL:            {PROCESS_GPU_ENCODE_UTIL, prometheus.GaugeValue, "Process GPU encode util (in %)."},
+		PROCESS_GPU_MEM_USED_BYTES:         {PROCESS_GPU_MEM_USED_BYTES, prometheus.GaugeValue, "Process GPU memory used bytes."},
+		PROCESS_GPU_ENCODER_SESSIONS:       {PROCESS_GPU_ENCODER_SESSIONS, prometheus.GaugeValue, "Process GPU encoder sessions."},
+		PROCESS_GPU_NUMA_MISMATCH:          {PROCESS_GPU_NUMA_MISMATCH, prometheus.GaugeValue, "1 if the process may only run on CPUs or NUMA nodes not local to its GPU."},
+	}
+)
+
+var (
+	// METRIC_EXTRA_LABELS are appended to GPULabels of GPU metrics with more
+	// than one series per GPU, values come from GetLabeledValuesFromMetricName
+	METRIC_EXTRA_LABELS = map[string][]string{
+		GPU_CLOCK_CURRENT:             {LabelClockDomain},
+		GPU_CLOCK_MAX:                 {LabelClockDomain},
+		GPU_CLOCK_APPLICATION:         {LabelClockDomain},
+		GPU_CLOCK_DEFAULT_APPLICATION: {LabelClockDomain},
+		GPU_CLOCK_BOOST_MAX:           {LabelClockDomain},
+		GPU_CLOCK_PSTATE_MIN:          {LabelClockDomain},
+		GPU_CLOCK_PSTATE_MAX:          {LabelClockDomain},
+		GPU_CLOCK_VF_OFFSET:           {LabelClockDomain},
+		GPU_CLOCK_VF_OFFSET_MIN:       {LabelClockDomain},
+		GPU_CLOCK_VF_OFFSET_MAX:       {LabelClockDomain},
+		GPU_DOWN_INFO:                 {LabelReason},
+		GPU_FAN_SPEED:                 {LabelFan},
+		GPU_FAN_TARGET_SPEED:          {LabelFan},
+		GPU_FAN_CONTROL_POLICY:        {LabelFan},
+		GPU_PROF_GR_ENGINE_ACTIVE:     {LabelSource},
+		GPU_PROF_SM_ACTIVE:            {LabelSource},
+		GPU_PROF_SM_OCCUPANCY:         {LabelSource},
+		GPU_PROF_TENSOR_ACTIVE:        {LabelSource},
+		GPU_PROF_DRAM_ACTIVE:          {LabelSource},
+		GPU_PROF_FP64_ACTIVE:          {LabelSource},
+		GPU_PROF_FP32_ACTIVE:          {LabelSource},
+		GPU_PROF_FP16_ACTIVE:          {LabelSource},
+		GPU_PROF_PCIE_TX_BYTES:        {LabelSource},
+		GPU_PROF_PCIE_RX_BYTES:        {LabelSource},
+		GPU_PROF_NVLINK_TX_BYTES:      {LabelSource},
+		GPU_PROF_NVLINK_RX_BYTES:      {LabelSource},
+	}
+)
+
+// MetricV2Meta is the name of a metric in the v2 naming scheme, which follows the
+// Prometheus conventions: the nvml namespace, base units (seconds, hertz, joules,
+// ratios in 0-1) and a _total suffix on counters. Scale converts the collected
+// value to the base unit.
+type MetricV2Meta struct {
+	Name  string
+	Scale float64
+	Help  string
+}
+
+var (
+	// METRIC_V2_META_MAP maps the legacy metric names to their v2 name, the
+	// type and labels are those of METRIC_META_MAP. Deprecated metrics have no
+	// v2 name.
+	METRIC_V2_META_MAP = map[string]MetricV2Meta{
+		GPU_INFO:                           {"nvml_gpu_info", 1, "GPU info, driver and board details in labels."},
+		GPU_NUMA_INFO:                      {"nvml_gpu_numa_info", 1, "GPU NUMA node and CPU affinity in labels."},
+		GPU_TOPOLOGY_INFO:                  {"nvml_gpu_topology_info", 1, "GPU to GPU link type in labels, as in nvidia-smi topo -m."},
+		GPU_UP:                             {"nvml_gpu_up", 1, "Whether the GPU can be queried."},
+		GPU_DOWN_INFO:                      {"nvml_gpu_down_info", 1, "Why the GPU cannot be queried in the reason label, only while it is down."},
+		GPU_SM_CLOCK:                       {"nvml_gpu_sm_clock_hertz", 1e6, "SM clock frequency in hertz."},
+		GPU_MEMORY_CLOCK:                   {"nvml_gpu_memory_clock_hertz", 1e6, "Memory clock frequency in hertz."},
+		GPU_CLOCK_CURRENT:                  {"nvml_gpu_clock_current_hertz", 1e6, "Current clock frequency per domain in hertz."},
+		GPU_CLOCK_MAX:                      {"nvml_gpu_clock_max_hertz", 1e6, "Max clock frequency per domain in hertz."},
+		GPU_CLOCK_APPLICATION:              {"nvml_gpu_clock_application_hertz", 1e6, "Target application clock frequency per domain in hertz."},
+		GPU_CLOCK_DEFAULT_APPLICATION:      {"nvml_gpu_clock_default_application_hertz", 1e6, "Default application clock frequency per domain in hertz."},
+		GPU_CLOCK_BOOST_MAX:                {"nvml_gpu_clock_boost_max_hertz", 1e6, "OEM defined max boost clock frequency per domain in hertz."},
+		GPU_CLOCK_PSTATE_MIN:               {"nvml_gpu_clock_pstate_min_hertz", 1e6, "Min clock frequency of the current P-state per domain in hertz."},
+		GPU_CLOCK_PSTATE_MAX:               {"nvml_gpu_clock_pstate_max_hertz", 1e6, "Max clock frequency of the current P-state per domain in hertz."},
+		GPU_CLOCK_VF_OFFSET:                {"nvml_gpu_clock_vf_offset_hertz", 1e6, "Clock offset of the voltage/frequency curve per domain in hertz."},
+		GPU_CLOCK_VF_OFFSET_MIN:            {"nvml_gpu_clock_vf_offset_min_hertz", 1e6, "Min settable clock offset of the voltage/frequency curve per domain in hertz."},
+		GPU_CLOCK_VF_OFFSET_MAX:            {"nvml_gpu_clock_vf_offset_max_hertz", 1e6, "Max settable clock offset of the voltage/frequency curve per domain in hertz."},
+		GPU_TEMPERATURE:                    {"nvml_gpu_temperature_celsius", 1, "GPU temperature in celsius."},
+		GPU_MEMORY_TEMPERATURE:             {"nvml_gpu_memory_temperature_celsius", 1, "HBM memory temperature in celsius."},
+		GPU_TEMPERATURE_SLOWDOWN_THRESHOLD: {"nvml_gpu_temperature_slowdown_threshold_celsius", 1, "Temperature at which the GPU slows down in celsius."},
+		GPU_TEMPERATURE_SHUTDOWN_THRESHOLD: {"nvml_gpu_temperature_shutdown_threshold_celsius", 1, "Temperature at which the GPU shuts down in celsius."},
+		GPU_FAN_SPEED:                      {"nvml_gpu_fan_speed_ratio", 0.01, "Fan speed as a ratio of the max speed (0-1)."},
+		GPU_FAN_TARGET_SPEED:               {"nvml_gpu_fan_target_speed_ratio", 0.01, "Fan speed the driver aims for as a ratio of the max speed (0-1)."},
+		GPU_FAN_CONTROL_POLICY:             {"nvml_gpu_fan_control_policy", 1, "Fan control policy, 0 if controlled by the driver, 1 if set manually."},
+		GPU_POWER_USAGE:                    {"nvml_gpu_power_usage_watts", 1, "Power draw in watts."},
+		GPU_TOTAL_ENERGY_CONSUMPTION:       {"nvml_gpu_energy_joules_total", 0.001, "Total energy consumption since boot in joules."},
+		GPU_POWER_LIMIT:                    {"nvml_gpu_power_limit_watts", 1, "Enforced power limit in watts."},
+		GPU_POWER_DEFAULT_LIMIT:            {"nvml_gpu_power_default_limit_watts", 1, "Default power management limit in watts."},
+		GPU_POWER_MIN_LIMIT:                {"nvml_gpu_power_min_limit_watts", 1, "Minimum settable power management limit in watts."},
+		GPU_POWER_MAX_LIMIT:                {"nvml_gpu_power_max_limit_watts", 1, "Maximum settable power management limit in watts."},
+		GPU_POWER_MANAGEMENT_MODE:          {"nvml_gpu_power_management_mode", 1, "Power management mode, 1 if enabled."},
+		GPU_POWER_STATE:                    {"nvml_gpu_power_state", 1, "Performance state (P-state) 0-15, -1 if unknown."},
+		GPU_PCIE_TX_BYTES_PER_SECOND:       {"nvml_gpu_pcie_tx_bytes_per_second", 1, "PCIe TX throughput sampled over 20ms in bytes per second."},
+		GPU_PCIE_RX_BYTES_PER_SECOND:       {"nvml_gpu_pcie_rx_bytes_per_second", 1, "PCIe RX throughput sampled over 20ms in bytes per second."},
+		GPU_PCIE_TX_BYTES_TOTAL:            {"nvml_gpu_pcie_tx_bytes_total", 1, "Total PCIe TX bytes since exporter start, integrated from throughput samples."},
+		GPU_PCIE_RX_BYTES_TOTAL:            {"nvml_gpu_pcie_rx_bytes_total", 1, "Total PCIe RX bytes since exporter start, integrated from throughput samples."},
+		GPU_PCIE_LINK_GEN_CURRENT:          {"nvml_gpu_pcie_link_gen_current", 1, "Current PCIe link generation."},
+		GPU_PCIE_LINK_GEN_MAX:              {"nvml_gpu_pcie_link_gen_max", 1, "Max PCIe link generation supported by the GPU and system."},
+		GPU_PCIE_LINK_WIDTH_CURRENT:        {"nvml_gpu_pcie_link_width_current_lanes", 1, "Current PCIe link width in lanes."},
+		GPU_PCIE_LINK_WIDTH_MAX:            {"nvml_gpu_pcie_link_width_max_lanes", 1, "Max PCIe link width in lanes."},
+		GPU_PCIE_REPLAY_COUNTER:            {"nvml_gpu_pcie_replays_total", 1, "Total PCIe replays."},
+		GPU_PCIE_LINK_DEGRADED:             {"nvml_gpu_pcie_link_degraded", 1, "1 if the PCIe link runs below its max width while the GPU is busy."},
+		GPU_UTILIZATION:                    {"nvml_gpu_utilization_ratio", 0.01, "Ratio of time a kernel was running on the GPU (0-1)."},
+		GPU_MEM_COPY_UTILIZATION:           {"nvml_gpu_memory_copy_utilization_ratio", 0.01, "Ratio of time the memory was read or written (0-1)."},
+		GPU_ENC_UTILIZATION:                {"nvml_gpu_encoder_utilization_ratio", 0.01, "Encoder utilization (0-1)."},
+		GPU_DEC_UTILIZATION:                {"nvml_gpu_decoder_utilization_ratio", 0.01, "Decoder utilization (0-1)."},
+		GPU_ENCODER_SESSION_COUNT:          {"nvml_gpu_encoder_sessions", 1, "Number of active encoder sessions."},
+		GPU_ENCODER_AVERAGE_FPS:            {"nvml_gpu_encoder_average_fps", 1, "Average FPS of all encoder sessions."},
+		GPU_ENCODER_AVERAGE_LATENCY:        {"nvml_gpu_encoder_average_latency_seconds", 1e-6, "Average latency of all encoder sessions in seconds."},
+		GPU_FBC_SESSION_COUNT:              {"nvml_gpu_fbc_sessions", 1, "Number of active frame buffer capture sessions."},
+		GPU_FBC_AVERAGE_FPS:                {"nvml_gpu_fbc_average_fps", 1, "Average FPS of all frame buffer capture sessions."},
+		GPU_FBC_AVERAGE_LATENCY:            {"nvml_gpu_fbc_average_latency_seconds", 1e-6, "Average latency of all frame buffer capture sessions in seconds."},
+		GPU_PROF_GR_ENGINE_ACTIVE:          {"nvml_gpu_prof_gr_engine_active_ratio", 1, "Ratio of time the graphics engine is active (0-1)."},
+		GPU_PROF_SM_ACTIVE:                 {"nvml_gpu_prof_sm_active_ratio", 1, "Ratio of cycles an SM has at least 1 warp assigned (0-1)."},
+		GPU_PROF_SM_OCCUPANCY:              {"nvml_gpu_prof_sm_occupancy_ratio", 1, "Ratio of number of warps resident on an SM to the max (0-1)."},
+		GPU_PROF_TENSOR_ACTIVE:             {"nvml_gpu_prof_tensor_active_ratio", 1, "Ratio of cycles the tensor (HMMA) pipe is active (0-1)."},
+		GPU_PROF_DRAM_ACTIVE:               {"nvml_gpu_prof_dram_active_ratio", 1, "Ratio of cycles the device memory interface is active sending or receiving data (0-1)."},
+		GPU_PROF_FP64_ACTIVE:               {"nvml_gpu_prof_fp64_active_ratio", 1, "Ratio of cycles the fp64 pipe is active (0-1)."},
+		GPU_PROF_FP32_ACTIVE:               {"nvml_gpu_prof_fp32_active_ratio", 1, "Ratio of cycles the fp32 pipe is active (0-1)."},
+		GPU_PROF_FP16_ACTIVE:               {"nvml_gpu_prof_fp16_active_ratio", 1, "Ratio of cycles the fp16 pipe is active (0-1)."},
+		GPU_PROF_PCIE_TX_BYTES:             {"nvml_gpu_prof_pcie_tx_bytes_per_second", 1, "The rate of data transmitted over the PCIe bus, including headers, in bytes per second."},
+		GPU_PROF_PCIE_RX_BYTES:             {"nvml_gpu_prof_pcie_rx_bytes_per_second", 1, "The rate of data received over the PCIe bus, including headers, in bytes per second."},
+		GPU_PROF_NVLINK_TX_BYTES:           {"nvml_gpu_prof_nvlink_tx_bytes_per_second", 1, "The rate of data transmitted over NVLink in bytes per second."},
+		GPU_PROF_NVLINK_RX_BYTES:           {"nvml_gpu_prof_nvlink_rx_bytes_per_second", 1, "The rate of data received over NVLink in bytes per second."},
+		GPU_MEMORY_FREE_BYTES:              {"nvml_gpu_memory_free_bytes", 1, "Framebuffer memory free in bytes."},
+		GPU_MEMORY_USED_BYTES:              {"nvml_gpu_memory_used_bytes", 1, "Framebuffer memory used in bytes."},
+		GPU_MEMORY_TOTAL_BYTES:             {"nvml_gpu_memory_total_bytes", 1, "Framebuffer memory total in bytes."},
+		GPU_MEMORY_RESERVED_BYTES:          {"nvml_gpu_memory_reserved_bytes", 1, "Framebuffer memory reserved by the driver and firmware in bytes."},
+		GPU_BAR1_TOTAL_BYTES:               {"nvml_gpu_bar1_total_bytes", 1, "BAR1 memory total in bytes."},
+		GPU_BAR1_USED_BYTES:                {"nvml_gpu_bar1_used_bytes", 1, "BAR1 memory used in bytes."},
+		GPU_BAR1_FREE_BYTES:                {"nvml_gpu_bar1_free_bytes", 1, "BAR1 memory free in bytes."},
+		PROCESS_INFO:                       {"nvml_process_info", 1, "Process info, working directory and command line in labels."},
+		PROCESS_CPU_PERCENT:                {"nvml_process_cpu_utilization_ratio", 0.01, "Process CPU utilization, 1 is one full CPU."},
+		PROCESS_CPU_MEM_USED_BYTES:         {"nvml_process_cpu_memory_used_bytes", 1, "Process resident memory in bytes."},
+		PROCESS_NUM_THREADS:                {"nvml_process_threads", 1, "Number of threads of the process."},
+		PROCESS_GPU_SM_UTIL:                {"nvml_process_gpu_sm_utilization_ratio", 0.01, "Process GPU SM utilization (0-1)."},
+		PROCESS_GPU_MEM_UTIL:               {"nvml_process_gpu_memory_utilization_ratio", 0.01, "Process GPU memory utilization (0-1)."},
+		PROCESS_GPU_DECODE_UTIL:            {"nvml_process_gpu_decoder_utilization_ratio", 0.01, "Process GPU decoder utilization (0-1)."},
+		PROCESS_GPU_ENCODE_UTIL:            {"nvml_process_gpu_encoder_utilization_ratio", 0.01, "Process GPU encoder utilization (0-1)."},
+		PROCESS_GPU_MEM_USED_BYTES:         {"nvml_process_gpu_memory_used_bytes", 1, "Process GPU memory used in bytes."},
+		PROCESS_GPU_ENCODER_SESSIONS:       {"nvml_process_gpu_encoder_sessions", 1, "Number of encoder sessions of the process."},
+		PROCESS_GPU_NUMA_MISMATCH:          {"nvml_process_gpu_numa_mismatch", 1, "1 if the process may only run on CPUs or NUMA nodes not local to its GPU."},
 	}
 )
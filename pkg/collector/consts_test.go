@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetricV2Units(t *testing.T) {
+	gpu := GPUStat{
+		SMClock:                1410,
+		PowerUsage:             250.5,
+		TotalEnergyConsumption: 2500, // mJ
+	}
+	tests := []struct {
+		metric string
+		name   string
+		want   float64
+	}{
+		{GPU_SM_CLOCK, "nvml_gpu_sm_clock_hertz", 1410e6},
+		{GPU_POWER_USAGE, "nvml_gpu_power_usage_watts", 250.5},
+		{GPU_TOTAL_ENERGY_CONSUMPTION, "nvml_gpu_energy_joules_total", 2.5},
+	}
+	for _, tt := range tests {
+		v2, ok := METRIC_V2_META_MAP[tt.metric]
+		if !ok {
+			t.Fatalf("%v has no v2 name", tt.metric)
+		}
+		if v2.Name != tt.name {
+			t.Errorf("%v: v2 name %v, want %v", tt.metric, v2.Name, tt.name)
+		}
+		if got := gpu.GetValueFromMetricName(tt.metric) * v2.Scale; got != tt.want {
+			t.Errorf("%v: %v, want %v", v2.Name, got, tt.want)
+		}
+	}
+}
+
+func TestMetricV2Names(t *testing.T) {
+	names := make(map[string]string)
+	for metric, v2 := range METRIC_V2_META_MAP {
+		if _, ok := METRIC_META_MAP[metric]; !ok {
+			t.Errorf("%v has a v2 name but no legacy meta", metric)
+		}
+		if !strings.HasPrefix(v2.Name, "nvml_") {
+			t.Errorf("%v: v2 name %v is not prefixed with nvml_", metric, v2.Name)
+		}
+		if other, ok := names[v2.Name]; ok {
+			t.Errorf("%v and %v have the same v2 name %v", metric, other, v2.Name)
+		}
+		names[v2.Name] = metric
+		if v2.Scale == 0 {
+			t.Errorf("%v: zero scale", v2.Name)
+		}
+	}
+}
+
+func TestMemoryTemperatureUnsupported(t *testing.T) {
+	for _, naming := range []string{NamingBoth, NamingDCGM} {
+		config := &Config{HostName: "node1", Naming: naming}
+		newCache := func(memoryTemperature int32) *NVMLCache {
+			return &NVMLCache{
+				config:      config,
+				GPUStats:    []GPUStat{{UUID: "GPU-a", GPULabel: "0", Up: true, Temperature: 40, MemoryTemperature: memoryTemperature}},
+				DeviceInfos: []GPUDevice{{GPUInfo: GPUInfo{UUID: "GPU-a"}}},
+			}
+		}
+		names := []string{GPU_MEMORY_TEMPERATURE, METRIC_V2_META_MAP[GPU_MEMORY_TEMPERATURE].Name}
+		if naming == NamingDCGM {
+			names = []string{"DCGM_FI_DEV_MEMORY_TEMP"}
+		}
+
+		values := gatherValues(t, NewGPUCollector(config, newCache(-1)))
+		for _, name := range names {
+			if _, ok := values[name]; ok {
+				t.Errorf("%v is exported while not supported", name)
+			}
+		}
+		values = gatherValues(t, NewGPUCollector(config, newCache(55)))
+		for _, name := range names {
+			if values[name] != 55 {
+				t.Errorf("%v: %v, want 55", name, values[name])
+			}
+		}
+	}
+}
+
+func TestPowerLimitsUnsupported(t *testing.T) {
+	config := &Config{HostName: "node1", Naming: NamingBoth}
+	newCache := func(minLimit, maxLimit float64) *NVMLCache {
+		return &NVMLCache{
+			config:      config,
+			GPUStats:    []GPUStat{{UUID: "GPU-a", GPULabel: "0", Up: true, PowerMinLimit: minLimit, PowerMaxLimit: maxLimit}},
+			DeviceInfos: []GPUDevice{{GPUInfo: GPUInfo{UUID: "GPU-a"}}},
+		}
+	}
+	names := []string{GPU_POWER_MIN_LIMIT, GPU_POWER_MAX_LIMIT,
+		METRIC_V2_META_MAP[GPU_POWER_MIN_LIMIT].Name, METRIC_V2_META_MAP[GPU_POWER_MAX_LIMIT].Name}
+
+	values := gatherValues(t, NewGPUCollector(config, newCache(-1, -1)))
+	for _, name := range names {
+		if _, ok := values[name]; ok {
+			t.Errorf("%v is exported while not supported", name)
+		}
+	}
+	values = gatherValues(t, NewGPUCollector(config, newCache(100, 400)))
+	for i, name := range names {
+		if want := []float64{100, 400}[i%2]; values[name] != want {
+			t.Errorf("%v: %v, want %v", name, values[name], want)
+		}
+	}
+}
+
+func TestClockVfOffset(t *testing.T) {
+	gpu := GPUStat{Clocks: []ClockStat{
+		{Domain: "graphics", Max: 1980, VfOffset: -100, VfOffsetMin: -200, VfOffsetMax: 1000, HasVfOffset: true},
+		{Domain: "sm", Max: 1980},
+		{Domain: "memory", Max: 1593, HasVfOffset: true},
+	}}
+	tests := []struct {
+		metric string
+		want   map[string]float64 // per domain
+	}{
+		{GPU_CLOCK_VF_OFFSET, map[string]float64{"graphics": -100, "memory": 0}},
+		{GPU_CLOCK_VF_OFFSET_MIN, map[string]float64{"graphics": -200, "memory": 0}},
+		{GPU_CLOCK_VF_OFFSET_MAX, map[string]float64{"graphics": 1000, "memory": 0}},
+	}
+	for _, tt := range tests {
+		values := gpu.GetLabeledValuesFromMetricName(tt.metric)
+		if len(values) != len(tt.want) {
+			t.Errorf("%v: %v, want %v", tt.metric, values, tt.want)
+			continue
+		}
+		for _, v := range values {
+			if want, ok := tt.want[v.LabelValues[0]]; !ok || v.Value != want {
+				t.Errorf("%v{domain=%v}: %v, want %v", tt.metric, v.LabelValues[0], v.Value, want)
+			}
+		}
+	}
+}
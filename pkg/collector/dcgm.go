@@ -0,0 +1,241 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	DCGMTypeGauge   = "gauge"
+	DCGMTypeCounter = "counter"
+	DCGMTypeLabel   = "label"
+)
+
+// DCGMCounter is one line of a dcgm-exporter counters csv:
+// DCGM FIELD, Prometheus metric type, help message
+type DCGMCounter struct {
+	FieldName string
+	PromType  string
+	Help      string
+}
+
+// DCGMField is the NVML metric a DCGM field is collected from. Scale converts
+// the NVML value to the DCGM unit, e.g. bytes to MiB.
+type DCGMField struct {
+	MetricName string
+	Scale      float64
+}
+
+const (
+	bytesPerMiB = 1024 * 1024
+	bytesPerKiB = 1024
+)
+
+// DCGM_FIELD_MAP maps the DCGM fields that NVML can provide, label fields are
+// exported through gpu_info.
+var DCGM_FIELD_MAP = map[string]DCGMField{
+	// Clocks
+	"DCGM_FI_DEV_SM_CLOCK":  {GPU_SM_CLOCK, 1},
+	"DCGM_FI_DEV_MEM_CLOCK": {GPU_MEMORY_CLOCK, 1},
+
+	// Temperature
+	"DCGM_FI_DEV_GPU_TEMP":      {GPU_TEMPERATURE, 1},
+	"DCGM_FI_DEV_MEMORY_TEMP":   {GPU_MEMORY_TEMPERATURE, 1},
+	"DCGM_FI_DEV_SLOWDOWN_TEMP": {GPU_TEMPERATURE_SLOWDOWN_THRESHOLD, 1},
+	"DCGM_FI_DEV_SHUTDOWN_TEMP": {GPU_TEMPERATURE_SHUTDOWN_THRESHOLD, 1},
+
+	// Power
+	"DCGM_FI_DEV_POWER_USAGE":              {GPU_POWER_USAGE, 1},
+	"DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION": {GPU_TOTAL_ENERGY_CONSUMPTION, 1},
+	"DCGM_FI_DEV_POWER_MGMT_LIMIT":         {GPU_POWER_LIMIT, 1},
+	"DCGM_FI_DEV_ENFORCED_POWER_LIMIT":     {GPU_POWER_LIMIT, 1},
+	"DCGM_FI_DEV_POWER_MGMT_LIMIT_DEF":     {GPU_POWER_DEFAULT_LIMIT, 1},
+	"DCGM_FI_DEV_POWER_MGMT_LIMIT_MIN":     {GPU_POWER_MIN_LIMIT, 1},
+	"DCGM_FI_DEV_POWER_MGMT_LIMIT_MAX":     {GPU_POWER_MAX_LIMIT, 1},
+
+	// PCIe, DCGM_FI_DEV_PCIE_*_THROUGHPUT are in KB/s
+	"DCGM_FI_DEV_PCIE_TX_THROUGHPUT":  {GPU_PCIE_TX_BYTES_PER_SECOND, 1.0 / bytesPerKiB},
+	"DCGM_FI_DEV_PCIE_RX_THROUGHPUT":  {GPU_PCIE_RX_BYTES_PER_SECOND, 1.0 / bytesPerKiB},
+	"DCGM_FI_DEV_PCIE_REPLAY_COUNTER": {GPU_PCIE_REPLAY_COUNTER, 1},
+	"DCGM_FI_DEV_PCIE_LINK_GEN":       {GPU_PCIE_LINK_GEN_CURRENT, 1},
+	"DCGM_FI_DEV_PCIE_LINK_WIDTH":     {GPU_PCIE_LINK_WIDTH_CURRENT, 1},
+	"DCGM_FI_DEV_PCIE_MAX_LINK_GEN":   {GPU_PCIE_LINK_GEN_MAX, 1},
+	"DCGM_FI_DEV_PCIE_MAX_LINK_WIDTH": {GPU_PCIE_LINK_WIDTH_MAX, 1},
+
+	// Utilization
+	"DCGM_FI_DEV_GPU_UTIL":      {GPU_UTILIZATION, 1},
+	"DCGM_FI_DEV_MEM_COPY_UTIL": {GPU_MEM_COPY_UTILIZATION, 1},
+	"DCGM_FI_DEV_ENC_UTIL":      {GPU_ENC_UTILIZATION, 1},
+	"DCGM_FI_DEV_DEC_UTIL":      {GPU_DEC_UTILIZATION, 1},
+
+	// Profiling, from the ProfilingBackend or estimated from NVML
+	"DCGM_FI_PROF_GR_ENGINE_ACTIVE":   {GPU_PROF_GR_ENGINE_ACTIVE, 1},
+	"DCGM_FI_PROF_SM_ACTIVE":          {GPU_PROF_SM_ACTIVE, 1},
+	"DCGM_FI_PROF_SM_OCCUPANCY":       {GPU_PROF_SM_OCCUPANCY, 1},
+	"DCGM_FI_PROF_PIPE_TENSOR_ACTIVE": {GPU_PROF_TENSOR_ACTIVE, 1},
+	"DCGM_FI_PROF_DRAM_ACTIVE":        {GPU_PROF_DRAM_ACTIVE, 1},
+	"DCGM_FI_PROF_PIPE_FP64_ACTIVE":   {GPU_PROF_FP64_ACTIVE, 1},
+	"DCGM_FI_PROF_PIPE_FP32_ACTIVE":   {GPU_PROF_FP32_ACTIVE, 1},
+	"DCGM_FI_PROF_PIPE_FP16_ACTIVE":   {GPU_PROF_FP16_ACTIVE, 1},
+	"DCGM_FI_PROF_PCIE_TX_BYTES":      {GPU_PROF_PCIE_TX_BYTES, 1},
+	"DCGM_FI_PROF_PCIE_RX_BYTES":      {GPU_PROF_PCIE_RX_BYTES, 1},
+	"DCGM_FI_PROF_NVLINK_TX_BYTES":    {GPU_PROF_NVLINK_TX_BYTES, 1},
+	"DCGM_FI_PROF_NVLINK_RX_BYTES":    {GPU_PROF_NVLINK_RX_BYTES, 1},
+
+	// Memory usage, DCGM reports MiB
+	"DCGM_FI_DEV_FB_FREE":     {GPU_MEMORY_FREE_BYTES, 1.0 / bytesPerMiB},
+	"DCGM_FI_DEV_FB_USED":     {GPU_MEMORY_USED_BYTES, 1.0 / bytesPerMiB},
+	"DCGM_FI_DEV_FB_TOTAL":    {GPU_MEMORY_TOTAL_BYTES, 1.0 / bytesPerMiB},
+	"DCGM_FI_DEV_FB_RESERVED": {GPU_MEMORY_RESERVED_BYTES, 1.0 / bytesPerMiB},
+	"DCGM_FI_DEV_BAR1_TOTAL":  {GPU_BAR1_TOTAL_BYTES, 1.0 / bytesPerMiB},
+	"DCGM_FI_DEV_BAR1_USED":   {GPU_BAR1_USED_BYTES, 1.0 / bytesPerMiB},
+	"DCGM_FI_DEV_BAR1_FREE":   {GPU_BAR1_FREE_BYTES, 1.0 / bytesPerMiB},
+
+	// Static configuration information
+	"DCGM_FI_DRIVER_VERSION":      {GPU_INFO, 1},
+	"DCGM_FI_NVML_VERSION":        {GPU_INFO, 1},
+	"DCGM_FI_CUDA_DRIVER_VERSION": {GPU_INFO, 1},
+	"DCGM_FI_DEV_SERIAL":          {GPU_INFO, 1},
+	"DCGM_FI_DEV_VBIOS_VERSION":   {GPU_INFO, 1},
+	"DCGM_FI_DEV_PCI_BUSID":       {GPU_INFO, 1},
+	"DCGM_FI_DEV_NAME":            {GPU_INFO, 1},
+	"DCGM_FI_DEV_UUID":            {GPU_INFO, 1},
+}
+
+// DefaultDCGMCounters are the fields of dcgm-exporter's default-counters.csv
+// that NVML can provide
+var DefaultDCGMCounters = []DCGMCounter{
+	{"DCGM_FI_DEV_SM_CLOCK", DCGMTypeGauge, "SM clock frequency (in MHz)."},
+	{"DCGM_FI_DEV_MEM_CLOCK", DCGMTypeGauge, "Memory clock frequency (in MHz)."},
+	{"DCGM_FI_DEV_MEMORY_TEMP", DCGMTypeGauge, "Memory temperature (in C)."},
+	{"DCGM_FI_DEV_GPU_TEMP", DCGMTypeGauge, "GPU temperature (in C)."},
+	{"DCGM_FI_DEV_POWER_USAGE", DCGMTypeGauge, "Power draw (in W)."},
+	{"DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", DCGMTypeCounter, "Total energy consumption since boot (in mJ)."},
+	{"DCGM_FI_DEV_PCIE_REPLAY_COUNTER", DCGMTypeCounter, "Total number of PCIe retries."},
+	{"DCGM_FI_DEV_GPU_UTIL", DCGMTypeGauge, "GPU utilization (in %)."},
+	{"DCGM_FI_DEV_MEM_COPY_UTIL", DCGMTypeGauge, "Memory utilization (in %)."},
+	{"DCGM_FI_DEV_ENC_UTIL", DCGMTypeGauge, "Encoder utilization (in %)."},
+	{"DCGM_FI_DEV_DEC_UTIL", DCGMTypeGauge, "Decoder utilization (in %)."},
+	{"DCGM_FI_DEV_FB_FREE", DCGMTypeGauge, "Framebuffer memory free (in MiB)."},
+	{"DCGM_FI_DEV_FB_USED", DCGMTypeGauge, "Framebuffer memory used (in MiB)."},
+	{"DCGM_FI_DRIVER_VERSION", DCGMTypeLabel, "Driver Version"},
+}
+
+// dcgmLabelFields are the DCGM label fields NVML can provide, with their value
+var dcgmLabelFields = map[string]func(info GPUInfo) string{
+	"DCGM_FI_DRIVER_VERSION":      func(info GPUInfo) string { return info.DriverVersion },
+	"DCGM_FI_NVML_VERSION":        func(info GPUInfo) string { return info.NVMLVersion },
+	"DCGM_FI_CUDA_DRIVER_VERSION": func(info GPUInfo) string { return info.CudaDriverVersion },
+	"DCGM_FI_DEV_SERIAL":          func(info GPUInfo) string { return info.Serial },
+	"DCGM_FI_DEV_VBIOS_VERSION":   func(info GPUInfo) string { return info.VBIOSVersion },
+	"DCGM_FI_DEV_PCI_BUSID":       func(info GPUInfo) string { return info.PCIBusID },
+	"DCGM_FI_DEV_NAME":            func(info GPUInfo) string { return info.GPUModelName },
+	"DCGM_FI_DEV_UUID":            func(info GPUInfo) string { return info.UUID },
+}
+
+// dcgmDeviceName is the device label of dcgm-exporter, e.g. nvidia0
+func dcgmDeviceName(info GPUInfo) string {
+	if info.MinorNumber < 0 {
+		return fmt.Sprintf("nvidia%d", info.GPUIndex)
+	}
+	return fmt.Sprintf("nvidia%d", info.MinorNumber)
+}
+
+// DCGM_1X_FIELD_ALIASES maps the metric names of dcgm-exporter 1.x, as in
+// 1.x-compatibility-metrics.csv, to the DCGM fields
+var DCGM_1X_FIELD_ALIASES = map[string]string{
+	"dcgm_sm_clock":                   "DCGM_FI_DEV_SM_CLOCK",
+	"dcgm_memory_clock":               "DCGM_FI_DEV_MEM_CLOCK",
+	"dcgm_memory_temp":                "DCGM_FI_DEV_MEMORY_TEMP",
+	"dcgm_gpu_temp":                   "DCGM_FI_DEV_GPU_TEMP",
+	"dcgm_power_usage":                "DCGM_FI_DEV_POWER_USAGE",
+	"dcgm_total_energy_consumption":   "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION",
+	"dcgm_pcie_tx_throughput":         "DCGM_FI_DEV_PCIE_TX_THROUGHPUT",
+	"dcgm_pcie_rx_throughput":         "DCGM_FI_DEV_PCIE_RX_THROUGHPUT",
+	"dcgm_pcie_replay_counter":        "DCGM_FI_DEV_PCIE_REPLAY_COUNTER",
+	"dcgm_gpu_utilization":            "DCGM_FI_DEV_GPU_UTIL",
+	"dcgm_mem_copy_utilization":       "DCGM_FI_DEV_MEM_COPY_UTIL",
+	"dcgm_enc_utilization":            "DCGM_FI_DEV_ENC_UTIL",
+	"dcgm_dec_utilization":            "DCGM_FI_DEV_DEC_UTIL",
+	"dcgm_xid_errors":                 "DCGM_FI_DEV_XID_ERRORS",
+	"dcgm_fb_free":                    "DCGM_FI_DEV_FB_FREE",
+	"dcgm_fb_used":                    "DCGM_FI_DEV_FB_USED",
+	"dcgm_nvlink_bandwidth_total":     "DCGM_FI_DEV_NVLINK_BANDWIDTH_TOTAL",
+	"dcgm_fi_prof_gr_engine_active":   "DCGM_FI_PROF_GR_ENGINE_ACTIVE",
+	"dcgm_fi_prof_pipe_tensor_active": "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE",
+	"dcgm_fi_prof_dram_active":        "DCGM_FI_PROF_DRAM_ACTIVE",
+	"dcgm_fi_prof_pcie_tx_bytes":      "DCGM_FI_PROF_PCIE_TX_BYTES",
+	"dcgm_fi_prof_pcie_rx_bytes":      "DCGM_FI_PROF_PCIE_RX_BYTES",
+}
+
+// LookupDCGMField returns the NVML metric of a DCGM field or 1.x metric name
+func LookupDCGMField(fieldName string) (DCGMField, bool) {
+	if alias, ok := DCGM_1X_FIELD_ALIASES[fieldName]; ok {
+		fieldName = alias
+	}
+	field, ok := DCGM_FIELD_MAP[fieldName]
+	return field, ok
+}
+
+// ParseDCGMCounters reads a dcgm-exporter counters csv, lines starting with
+// '#' are comments.
+func ParseDCGMCounters(filePath string) ([]DCGMCounter, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read counters file, err: %v", err)
+	}
+	defer f.Close()
+
+	counters := make([]DCGMCounter, 0)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// the help message may contain commas
+		fields := strings.SplitN(line, ",", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected `field, type, help`, got %q", lineNum, line)
+		}
+		counter := DCGMCounter{
+			FieldName: strings.TrimSpace(fields[0]),
+			PromType:  strings.TrimSpace(fields[1]),
+			Help:      strings.TrimSpace(fields[2]),
+		}
+		switch counter.PromType {
+		case DCGMTypeGauge, DCGMTypeCounter, DCGMTypeLabel:
+		default:
+			return nil, fmt.Errorf("line %d: unknown metric type %q", lineNum, counter.PromType)
+		}
+		counters = append(counters, counter)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read counters file, err: %v", err)
+	}
+	return counters, nil
+}
+
+// DCGMCountersToMetrics returns the NVML metric names to collect for the
+// counters, and the fields NVML cannot provide.
+func DCGMCountersToMetrics(counters []DCGMCounter) ([]string, []string) {
+	metrics := make([]string, 0, len(counters))
+	unsupported := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, counter := range counters {
+		field, ok := LookupDCGMField(counter.FieldName)
+		if !ok {
+			unsupported = append(unsupported, counter.FieldName)
+			continue
+		}
+		if !seen[field.MetricName] {
+			seen[field.MetricName] = true
+			metrics = append(metrics, field.MetricName)
+		}
+	}
+	return metrics, unsupported
+}
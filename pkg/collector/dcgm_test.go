@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatherValues collects c and returns the value of every series by metric name,
+// metrics with several series keep the last one
+func gatherValues(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	values := make(map[string]float64)
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			switch {
+			case m.Gauge != nil:
+				values[mf.GetName()] = m.Gauge.GetValue()
+			case m.Counter != nil:
+				values[mf.GetName()] = m.Counter.GetValue()
+			}
+		}
+	}
+	return values
+}
+
+func TestDCGMUnits(t *testing.T) {
+	config := &Config{HostName: "node1", Naming: NamingDCGM}
+	cache := &NVMLCache{
+		config: config,
+		GPUStats: []GPUStat{{
+			UUID:                   "GPU-a",
+			Up:                     true,
+			PowerUsage:             250.5,
+			TotalEnergyConsumption: 2500, // mJ
+			MemoryUsedBytes:        3 * bytesPerMiB,
+		}},
+		DeviceInfos: []GPUDevice{{GPUInfo: GPUInfo{UUID: "GPU-a", MinorNumber: 0}}},
+	}
+	values := gatherValues(t, NewGPUCollector(config, cache))
+	tests := []struct {
+		name string
+		want float64
+	}{
+		{"DCGM_FI_DEV_POWER_USAGE", 250.5},
+		{"DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", 2500},
+		{"DCGM_FI_DEV_FB_USED", 3},
+	}
+	for _, tt := range tests {
+		got, ok := values[tt.name]
+		if !ok {
+			t.Errorf("%v is not exported", tt.name)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%v: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDCGMGPULabel(t *testing.T) {
+	config := &Config{HostName: "node1", Naming: NamingDCGM, GPULabel: GPULabelMinor}
+	cache := &NVMLCache{
+		config:      config,
+		GPUStats:    []GPUStat{{GPUIndex: 0, UUID: "GPU-a", MinorNumber: 3, GPULabel: "3", Up: true}},
+		DeviceInfos: []GPUDevice{{GPUInfo: GPUInfo{UUID: "GPU-a", MinorNumber: 3}}},
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewGPUCollector(config, cache))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	if len(mfs) == 0 {
+		t.Fatal("no metrics")
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			for _, lp := range m.Label {
+				if lp.GetName() == "gpu" && lp.GetValue() != "3" {
+					t.Errorf("%v: gpu=%q, want the minor number 3", mf.GetName(), lp.GetValue())
+				}
+			}
+		}
+	}
+}
+
+func TestParseDCGMCounters(t *testing.T) {
+	counters, err := ParseDCGMCounters("../dcgm_etc/default-counters.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, _ := DCGMCountersToMetrics(counters)
+	found := false
+	for _, metric := range metrics {
+		if metric == GPU_TOTAL_ENERGY_CONSUMPTION {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("default counters do not collect %v", GPU_TOTAL_ENERGY_CONSUMPTION)
+	}
+}
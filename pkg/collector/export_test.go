@@ -0,0 +1,7 @@
+package collector
+
+// UpdateProfiling exposes updateProfiling to the tests of collector_test,
+// which can import packages that depend on collector such as dcgm
+func (c *NVMLCache) UpdateProfiling(newGPUStat []GPUStat) {
+	c.updateProfiling(newGPUStat)
+}
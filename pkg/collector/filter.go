@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// GPUFilter is the `gpus` section of the metric config file, it selects the
+// GPUs to monitor. A GPU is monitored if it matches Include, or Include is
+// empty, and does not match Exclude.
+type GPUFilter struct {
+	Include GPUSelector `yaml:"include"`
+	Exclude GPUSelector `yaml:"exclude"`
+}
+
+// GPUSelector matches a GPU if any of its fields does
+type GPUSelector struct {
+	Indexes   []uint   `yaml:"indexes"`   // nvml index, as nvidia-smi
+	UUIDs     []string `yaml:"uuids"`     // e.g. GPU-5f1c...
+	PCIBusIDs []string `yaml:"pciBusIDs"` // e.g. 00000000:3B:00.0 or 0000:3b:00.0
+	Models    []string `yaml:"models"`    // regexes matched in the model name, e.g. A100
+
+	models []*regexp.Regexp
+}
+
+// Compile compiles the model regexes, it must be called before the filter is used
+func (f *GPUFilter) Compile() error {
+	for _, s := range []*GPUSelector{&f.Include, &f.Exclude} {
+		s.models = make([]*regexp.Regexp, 0, len(s.Models))
+		for _, model := range s.Models {
+			regex, err := regexp.Compile(model)
+			if err != nil {
+				return fmt.Errorf("invalid model regex %q, err: %v", model, err)
+			}
+			s.models = append(s.models, regex)
+		}
+	}
+	return nil
+}
+
+// Selects reports whether the GPU is monitored, a nil filter selects all GPUs
+func (f *GPUFilter) Selects(info *GPUInfo) bool {
+	if f == nil {
+		return true
+	}
+	if !f.Include.empty() && !f.Include.matches(info) {
+		return false
+	}
+	return !f.Exclude.matches(info)
+}
+
+// byIndex reports whether the filter only uses indexes, so it can select a GPU
+// whose other fields are unknown
+func (f *GPUFilter) byIndex() bool {
+	if f == nil {
+		return true
+	}
+	for _, s := range []*GPUSelector{&f.Include, &f.Exclude} {
+		if len(s.UUIDs) > 0 || len(s.PCIBusIDs) > 0 || len(s.Models) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *GPUSelector) empty() bool {
+	return len(s.Indexes) == 0 && len(s.UUIDs) == 0 && len(s.PCIBusIDs) == 0 && len(s.Models) == 0
+}
+
+func (s *GPUSelector) matches(info *GPUInfo) bool {
+	for _, index := range s.Indexes {
+		if index == info.GPUIndex {
+			return true
+		}
+	}
+	for _, uuid := range s.UUIDs {
+		if strings.EqualFold(uuid, info.UUID) {
+			return true
+		}
+	}
+	for _, busID := range s.PCIBusIDs {
+		if info.PCIBusID != "" && sysfsPCIAddress(busID) == sysfsPCIAddress(info.PCIBusID) {
+			return true
+		}
+	}
+	for _, model := range s.models {
+		if model.MatchString(info.GPUModelName) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package collector
+
+import "testing"
+
+func TestGPUFilterSelects(t *testing.T) {
+	gpus := []GPUInfo{
+		{GPUIndex: 0, UUID: "GPU-aaaa", PCIBusID: "00000000:3B:00.0", GPUModelName: "NVIDIA A100-SXM4-80GB"},
+		{GPUIndex: 1, UUID: "GPU-bbbb", PCIBusID: "00000000:5E:00.0", GPUModelName: "NVIDIA A100-SXM4-80GB"},
+		{GPUIndex: 2, UUID: "GPU-cccc", PCIBusID: "00000000:86:00.0", GPUModelName: "Tesla T4"},
+	}
+	tests := []struct {
+		name   string
+		filter *GPUFilter
+		want   []bool // per GPU
+	}{
+		{"nil", nil, []bool{true, true, true}},
+		{"empty", &GPUFilter{}, []bool{true, true, true}},
+		{"include models", &GPUFilter{Include: GPUSelector{Models: []string{"A100"}}}, []bool{true, true, false}},
+		{"exclude index", &GPUFilter{Exclude: GPUSelector{Indexes: []uint{1}}}, []bool{true, false, true}},
+		{"include and exclude", &GPUFilter{
+			Include: GPUSelector{Models: []string{"A100"}},
+			Exclude: GPUSelector{UUIDs: []string{"gpu-AAAA"}},
+		}, []bool{false, true, false}},
+		{"include pci bus id", &GPUFilter{Include: GPUSelector{PCIBusIDs: []string{"0000:5e:00.0", "00000000:86:00.0"}}}, []bool{false, true, true}},
+		{"include any field", &GPUFilter{Include: GPUSelector{Indexes: []uint{0}, Models: []string{"^Tesla"}}}, []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.filter != nil {
+				if err := tt.filter.Compile(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := range gpus {
+				if got := tt.filter.Selects(&gpus[i]); got != tt.want[i] {
+					t.Errorf("gpu %d: Selects() = %v, want %v", gpus[i].GPUIndex, got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if err := (&GPUFilter{Exclude: GPUSelector{Models: []string{"["}}}).Compile(); err == nil {
+		t.Error("invalid model regex did not fail")
+	}
+}
+
+func TestSelectsPlaceholder(t *testing.T) {
+	previous := []GPUDevice{
+		{GPUInfo: GPUInfo{GPUIndex: 0, UUID: "GPU-aaaa"}},
+		{GPUInfo: GPUInfo{GPUIndex: 1}}, // no handle on the previous scan either
+	}
+	tests := []struct {
+		name     string
+		filter   *GPUFilter
+		index    uint
+		previous []GPUDevice
+		want     bool
+	}{
+		{"no filter", nil, 2, nil, true},
+		{"excluded index", &GPUFilter{Exclude: GPUSelector{Indexes: []uint{2}}}, 2, nil, false},
+		{"included index", &GPUFilter{Include: GPUSelector{Indexes: []uint{2}}}, 2, nil, true},
+		{"unknown under uuid filter", &GPUFilter{Exclude: GPUSelector{UUIDs: []string{"GPU-cccc"}}}, 2, nil, false},
+		{"unknown under model filter", &GPUFilter{Include: GPUSelector{Models: []string{"A100"}}}, 2, previous, false},
+		{"selected before", &GPUFilter{Include: GPUSelector{Models: []string{"A100"}}}, 0, previous, true},
+		{"placeholder before", &GPUFilter{Exclude: GPUSelector{UUIDs: []string{"GPU-cccc"}}}, 1, previous, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.filter != nil {
+				if err := tt.filter.Compile(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := selectsPlaceholder(tt.filter, tt.index, tt.previous); got != tt.want {
+				t.Errorf("selectsPlaceholder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,28 +7,73 @@ import (
 )
 
 var (
-	GPULabels             = []string{"gpu", "UUID", "modelName"}
+	GPULabels             = []string{"gpu", "UUID", "modelName", "pciBusID", "minorNumber"}
 	getGPUStatLabelValues = func(gpu GPUStat) []string {
 		return []string{
-			fmt.Sprintf("%d", gpu.GPUIndex),
+			gpu.GPULabel,
 			gpu.UUID,
 			gpu.GPUModelName,
+			gpu.PCIBusID,
+			fmt.Sprintf("%d", gpu.MinorNumber),
 		}
 	}
+	GPUInfoLabels = []string{
+		"gpu", "UUID", "modelName", "pciBusID", "minorNumber",
+		"driverVersion", "cudaDriverVersion", "nvmlVersion", "vbiosVersion", "serial", "boardPartNumber",
+		"architecture", "computeCapability", "memoryTotalBytes", "persistenceMode", "computeMode",
+	}
+	// labels of dcgm-exporter, Hostname is a const label
+	DCGMLabels            = []string{"gpu", "UUID", LabelDevice, "modelName"}
+	GPUNUMAInfoLabels     = []string{"gpu", "UUID", "modelName", "pciBusID", "minorNumber", "numaNode", "cpuAffinity"}
+	GPUTopologyInfoLabels = []string{"gpu", "UUID", "modelName", "pciBusID", "minorNumber", "peerGPU", "peerUUID", "link"}
 	// [x]: configFiles
 	SupportedGGPUMetricsName = []string{
+		GPU_INFO,
+		GPU_NUMA_INFO,
+		GPU_TOPOLOGY_INFO,
+		GPU_UP,
+		GPU_DOWN_INFO,
 		GPU_SM_CLOCK,
 		GPU_MEMORY_CLOCK,
+		GPU_CLOCK_CURRENT,
+		GPU_CLOCK_MAX,
+		GPU_CLOCK_APPLICATION,
+		GPU_CLOCK_DEFAULT_APPLICATION,
+		GPU_CLOCK_BOOST_MAX,
+		GPU_CLOCK_PSTATE_MIN,
+		GPU_CLOCK_PSTATE_MAX,
+		GPU_CLOCK_VF_OFFSET,
+		GPU_CLOCK_VF_OFFSET_MIN,
+		GPU_CLOCK_VF_OFFSET_MAX,
 		//Temperature
 		GPU_TEMPERATURE,
+		GPU_MEMORY_TEMPERATURE,
+		GPU_TEMPERATURE_SLOWDOWN_THRESHOLD,
+		GPU_TEMPERATURE_SHUTDOWN_THRESHOLD,
 		GPU_FAN_SPEED,
+		GPU_FAN_TARGET_SPEED,
+		GPU_FAN_CONTROL_POLICY,
 		// Power
 		GPU_POWER_USAGE,
 		GPU_TOTAL_ENERGY_CONSUMPTION,
+		GPU_POWER_LIMIT,
+		GPU_POWER_DEFAULT_LIMIT,
+		GPU_POWER_MIN_LIMIT,
+		GPU_POWER_MAX_LIMIT,
+		GPU_POWER_MANAGEMENT_MODE,
+		GPU_POWER_STATE,
 
 		// PCIe
-		GPU_PCIE_TX_BYTES,
-		GPU_PCIE_RX_BYTES,
+		GPU_PCIE_TX_BYTES_PER_SECOND,
+		GPU_PCIE_RX_BYTES_PER_SECOND,
+		GPU_PCIE_TX_BYTES_TOTAL,
+		GPU_PCIE_RX_BYTES_TOTAL,
+		GPU_PCIE_LINK_GEN_CURRENT,
+		GPU_PCIE_LINK_GEN_MAX,
+		GPU_PCIE_LINK_WIDTH_CURRENT,
+		GPU_PCIE_LINK_WIDTH_MAX,
+		GPU_PCIE_REPLAY_COUNTER,
+		GPU_PCIE_LINK_DEGRADED,
 
 		// Utilization (the sample period varies depending on the product)
 		GPU_UTILIZATION,
@@ -36,21 +81,60 @@ var (
 		GPU_ENC_UTILIZATION,
 		GPU_DEC_UTILIZATION,
 
+		// Encoder and frame buffer capture sessions
+		GPU_ENCODER_SESSION_COUNT,
+		GPU_ENCODER_AVERAGE_FPS,
+		GPU_ENCODER_AVERAGE_LATENCY,
+		GPU_FBC_SESSION_COUNT,
+		GPU_FBC_AVERAGE_FPS,
+		GPU_FBC_AVERAGE_LATENCY,
+
+		// Profiling
+		GPU_PROF_GR_ENGINE_ACTIVE,
+		GPU_PROF_SM_ACTIVE,
+		GPU_PROF_SM_OCCUPANCY,
+		GPU_PROF_TENSOR_ACTIVE,
+		GPU_PROF_DRAM_ACTIVE,
+		GPU_PROF_FP64_ACTIVE,
+		GPU_PROF_FP32_ACTIVE,
+		GPU_PROF_FP16_ACTIVE,
+		GPU_PROF_PCIE_TX_BYTES,
+		GPU_PROF_PCIE_RX_BYTES,
+		GPU_PROF_NVLINK_TX_BYTES,
+		GPU_PROF_NVLINK_RX_BYTES,
+
 		// Memory usage
 		GPU_MEMORY_FREE_BYTES,
 		GPU_MEMORY_USED_BYTES,
+		GPU_MEMORY_TOTAL_BYTES,
+		GPU_MEMORY_RESERVED_BYTES,
+		GPU_BAR1_TOTAL_BYTES,
+		GPU_BAR1_USED_BYTES,
+		GPU_BAR1_FREE_BYTES,
 	}
 )
 
 type GPUCollector struct {
 	cache              *NVMLCache
-	metricDescs        map[string]*prometheus.Desc
+	metricDescs        map[string]*metricDesc
 	funcGetLabelValues func(gpu GPUStat) []string
 	config             *Config
+
+	// NamingV2 and NamingBoth, keyed by legacy name like metricDescs
+	v2Descs map[string]*metricDesc
+
+	// NamingDCGM only, keyed by DCGM field name like metricDescs
+	dcgmMetrics     map[string]dcgmMetric
+	dcgmLabelFields []string
+}
+
+type dcgmMetric struct {
+	field    DCGMField
+	promType prometheus.ValueType
 }
 
 func NewGPUCollector(config *Config, cache *NVMLCache) *GPUCollector {
-	metricsMap := make(map[string]*prometheus.Desc)
+	metricsMap := make(map[string]*metricDesc)
 	// 如果config是空的，用默认的SupportedGGPUMetricsName
 	if len(config.SupportedMetrics) > 0 {
 		SupportedGGPUMetricsName = []string{}
@@ -60,17 +144,44 @@ func NewGPUCollector(config *Config, cache *NVMLCache) *GPUCollector {
 			}
 		}
 	}
+	if config.Naming == NamingDCGM {
+		return newDCGMGPUCollector(config, cache)
+	}
+	v2Descs := make(map[string]*metricDesc)
 	for _, name := range SupportedGGPUMetricsName {
-		metricsMap[name] = prometheus.NewDesc(
-			name,
-			METRIC_META_MAP[name].Help,
-			GPULabels,
-			prometheus.Labels{LabelHostName: config.HostName},
-		)
-
+		labels := GPULabels
+		switch {
+		case name == GPU_INFO:
+			labels = GPUInfoLabels
+		case name == GPU_NUMA_INFO:
+			labels = GPUNUMAInfoLabels
+		case name == GPU_TOPOLOGY_INFO:
+			labels = GPUTopologyInfoLabels
+		case HasExtraLabels(name):
+			labels = append(append([]string{}, GPULabels...), METRIC_EXTRA_LABELS[name]...)
+		}
+		if config.legacyNames() {
+			metricsMap[name] = newMetricDesc(
+				config,
+				name,
+				METRIC_META_MAP[name].Help,
+				labels,
+				prometheus.Labels{LabelHostName: config.HostName},
+			)
+		}
+		if v2, ok := METRIC_V2_META_MAP[name]; ok && config.v2Names() {
+			v2Descs[name] = newMetricDesc(
+				config,
+				v2.Name,
+				v2.Help,
+				labels,
+				prometheus.Labels{LabelHostName: config.HostName},
+			)
+		}
 	}
 	return &GPUCollector{
 		metricDescs:        metricsMap,
+		v2Descs:            v2Descs,
 		cache:              cache,
 		config:             config,
 		funcGetLabelValues: getGPUStatLabelValues,
@@ -80,25 +191,174 @@ func NewGPUCollector(config *Config, cache *NVMLCache) *GPUCollector {
 
 func (c *GPUCollector) Describe(ch chan<- *prometheus.Desc) {
 	for _, desc := range c.metricDescs {
-		ch <- desc
+		ch <- desc.Desc
+	}
+	for _, desc := range c.v2Descs {
+		ch <- desc.Desc
 	}
 }
 
-func (c *GPUCollector) Collect(ch chan<- prometheus.Metric) {
+// newDCGMGPUCollector exports the collected metrics under the DCGM field names,
+// types, help and labels of config.DCGMCounters, like dcgm-exporter does.
+// Label fields are added as labels to every metric.
+func newDCGMGPUCollector(config *Config, cache *NVMLCache) *GPUCollector {
+	counters := config.DCGMCounters
+	if len(counters) == 0 {
+		counters = DefaultDCGMCounters
+	}
+	enabled := make(map[string]bool)
+	for _, name := range SupportedGGPUMetricsName {
+		enabled[name] = true
+	}
+
+	labelFields := make([]string, 0)
+	for _, counter := range counters {
+		if _, ok := dcgmLabelFields[counter.FieldName]; ok && counter.PromType == DCGMTypeLabel {
+			labelFields = append(labelFields, counter.FieldName)
+		}
+	}
+	labels := append(append([]string{}, DCGMLabels...), labelFields...)
+
+	metricsMap := make(map[string]*metricDesc)
+	dcgmMetrics := make(map[string]dcgmMetric)
+	for _, counter := range counters {
+		if counter.PromType == DCGMTypeLabel {
+			continue
+		}
+		field, ok := LookupDCGMField(counter.FieldName)
+		if !ok || !enabled[field.MetricName] || IsGPUInfoMetric(field.MetricName) {
+			continue
+		}
+		// dcgm-exporter has no source label, profiling metrics are exported without it
+		if HasExtraLabels(field.MetricName) && !IsProfilingMetric(field.MetricName) {
+			continue
+		}
+		promType := prometheus.GaugeValue
+		if counter.PromType == DCGMTypeCounter {
+			promType = prometheus.CounterValue
+		}
+		metricsMap[counter.FieldName] = newMetricDesc(
+			config,
+			counter.FieldName,
+			counter.Help,
+			labels,
+			prometheus.Labels{LabelHostName: config.HostName},
+		)
+		dcgmMetrics[counter.FieldName] = dcgmMetric{field: field, promType: promType}
+	}
+	return &GPUCollector{
+		metricDescs:        metricsMap,
+		cache:              cache,
+		config:             config,
+		funcGetLabelValues: getGPUStatLabelValues,
+		dcgmMetrics:        dcgmMetrics,
+		dcgmLabelFields:    labelFields,
+	}
+}
+
+func (c *GPUCollector) collectDCGM(ch chan<- prometheus.Metric) {
 	gpuCache := c.cache.GetGPUStats()
-	for metricName, desc := range c.metricDescs {
+	gpuInfos := make(map[uint]GPUInfo)
+	for _, info := range c.cache.GetGPUInfos() {
+		gpuInfos[info.GPUIndex] = info
+	}
+	for fieldName, desc := range c.metricDescs {
+		metric := c.dcgmMetrics[fieldName]
 		for _, gpu := range gpuCache {
-			value := gpu.GetValueFromMetricName(metricName)
-			metric := prometheus.MustNewConstMetric(
-				desc,
-				METRIC_META_MAP[metricName].PromType, // 从METRIC_META_MAP获取指标类型
-				value,
-				c.funcGetLabelValues(gpu)...,
-			)
-			if metric != nil {
-				ch <- metric
+			if !gpu.Up {
+				continue
 			}
+			info := gpuInfos[gpu.GPUIndex]
+			// gpu follows -gpu-label, as in the other namings
+			labelValues := []string{
+				gpu.GPULabel,
+				gpu.UUID,
+				dcgmDeviceName(info),
+				gpu.GPUModelName,
+			}
+			for _, labelField := range c.dcgmLabelFields {
+				labelValues = append(labelValues, dcgmLabelFields[labelField](info))
+			}
+			if !gpu.HasValue(metric.field.MetricName) {
+				continue
+			}
+			value := gpu.GetValueFromMetricName(metric.field.MetricName)
+			if IsProfilingMetric(metric.field.MetricName) {
+				profiling, ok := gpu.Profiling[metric.field.MetricName]
+				if !ok {
+					continue
+				}
+				value = profiling.Value
+			}
+			ch <- desc.mustNewConstMetric(
+				metric.promType,
+				value*metric.field.Scale,
+				labelValues...,
+			)
+		}
+	}
+}
 
+func (c *GPUCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.config.Naming == NamingDCGM {
+		c.collectDCGM(ch)
+		return
+	}
+	gpuCache := c.cache.GetGPUStats()
+	gpuInfos := make(map[uint]GPUInfo)
+	for _, info := range c.cache.GetGPUInfos() {
+		gpuInfos[info.GPUIndex] = info
+	}
+	for metricName, desc := range c.metricDescs {
+		c.collectMetric(ch, metricName, desc, 1, gpuCache, gpuInfos)
+	}
+	for metricName, desc := range c.v2Descs {
+		c.collectMetric(ch, metricName, desc, METRIC_V2_META_MAP[metricName].Scale, gpuCache, gpuInfos)
+	}
+}
+
+// collectMetric sends the series of metricName of every GPU to desc, values
+// are multiplied by scale
+func (c *GPUCollector) collectMetric(ch chan<- prometheus.Metric, metricName string, desc *metricDesc,
+	scale float64, gpuCache []GPUStat, gpuInfos map[uint]GPUInfo) {
+	for _, gpu := range gpuCache {
+		// a down gpu only has gpu_up, gpu_down_info, and the info metrics if it was seen up
+		if !gpu.Up && !IsGPUHealthMetric(metricName) && (!IsGPUInfoMetric(metricName) || gpu.UUID == "") {
+			continue
+		}
+		if HasExtraLabels(metricName) {
+			for _, lv := range gpu.GetLabeledValuesFromMetricName(metricName) {
+				ch <- desc.mustNewConstMetric(
+					METRIC_META_MAP[metricName].PromType,
+					lv.Value*scale,
+					append(c.funcGetLabelValues(gpu), lv.LabelValues...)...,
+				)
+			}
+			continue
+		}
+		if IsGPUInfoMetric(metricName) {
+			info := gpuInfos[gpu.GPUIndex]
+			for _, series := range info.GetInfoSeries(metricName, c.config.GPULabel) {
+				ch <- desc.mustNewConstMetric(
+					METRIC_META_MAP[metricName].PromType,
+					1,
+					append(c.funcGetLabelValues(gpu), series...)...,
+				)
+			}
+			continue
+		}
+		if !gpu.HasValue(metricName) {
+			continue
+		}
+		value := gpu.GetValueFromMetricName(metricName) * scale
+		labelValues := c.funcGetLabelValues(gpu)
+		metric := desc.mustNewConstMetric(
+			METRIC_META_MAP[metricName].PromType, // 从METRIC_META_MAP获取指标类型
+			value,
+			labelValues...,
+		)
+		if metric != nil {
+			ch <- metric
 		}
 	}
 }
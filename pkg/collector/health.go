@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// nvmlErrorNames are the reasons of gpu_down_info, named as the NVML_ERROR_ codes
+var nvmlErrorNames = map[nvml.Return]string{
+	nvml.ERROR_UNINITIALIZED:           "UNINITIALIZED",
+	nvml.ERROR_INVALID_ARGUMENT:        "INVALID_ARGUMENT",
+	nvml.ERROR_NO_PERMISSION:           "NO_PERMISSION",
+	nvml.ERROR_NOT_FOUND:               "NOT_FOUND",
+	nvml.ERROR_INSUFFICIENT_POWER:      "INSUFFICIENT_POWER",
+	nvml.ERROR_DRIVER_NOT_LOADED:       "DRIVER_NOT_LOADED",
+	nvml.ERROR_TIMEOUT:                 "TIMEOUT",
+	nvml.ERROR_IRQ_ISSUE:               "IRQ_ISSUE",
+	nvml.ERROR_CORRUPTED_INFOROM:       "CORRUPTED_INFOROM",
+	nvml.ERROR_GPU_IS_LOST:             "GPU_IS_LOST",
+	nvml.ERROR_RESET_REQUIRED:          "RESET_REQUIRED",
+	nvml.ERROR_OPERATING_SYSTEM:        "OPERATING_SYSTEM",
+	nvml.ERROR_LIB_RM_VERSION_MISMATCH: "LIB_RM_VERSION_MISMATCH",
+	nvml.ERROR_MEMORY:                  "MEMORY",
+	nvml.ERROR_UNKNOWN:                 "UNKNOWN",
+}
+
+func nvmlErrorName(ret nvml.Return) string {
+	if name, ok := nvmlErrorNames[ret]; ok {
+		return name
+	}
+	return fmt.Sprintf("ERROR_%d", int32(ret))
+}
+
+// health returns why the device cannot be queried, empty if it is up
+func (g *GPUDevice) health() string {
+	if g.handleError != "" {
+		return g.handleError
+	}
+	if _, ret := g.GetPciInfo(); ret != nvml.SUCCESS && ret != nvml.ERROR_NOT_SUPPORTED {
+		return nvmlErrorName(ret)
+	}
+	return ""
+}
+
+// downStat is the stat of a device that cannot be queried, only gpu_up,
+// gpu_down_info and the info metrics are exported for it
+func (g *GPUDevice) downStat(reason string) GPUStat {
+	return GPUStat{
+		GPUIndex:     g.GPUIndex,
+		UUID:         g.UUID,
+		GPUModelName: g.GPUModelName,
+		PCIBusID:     g.PCIBusID,
+		MinorNumber:  g.MinorNumber,
+		Error:        reason,
+	}
+}
+
+// sameDevices reports whether a rescan left the devices and their handles as is
+func sameDevices(a []GPUDevice, b []GPUDevice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].UUID != b[i].UUID || a[i].GPUIndex != b[i].GPUIndex || a[i].handleError != b[i].handleError {
+			return false
+		}
+	}
+	return true
+}
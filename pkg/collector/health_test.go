@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGPUDownInfo(t *testing.T) {
+	config := &Config{HostName: "node1", Naming: NamingBoth}
+	cache := &NVMLCache{
+		config: config,
+		GPUStats: []GPUStat{
+			{GPUIndex: 0, UUID: "GPU-a", GPULabel: "0", Up: true, Temperature: 40},
+			{GPUIndex: 1, UUID: "GPU-b", GPULabel: "1", Error: "GPU_IS_LOST"},
+		},
+		DeviceInfos: []GPUDevice{
+			{GPUInfo: GPUInfo{GPUIndex: 0, UUID: "GPU-a"}},
+			{GPUInfo: GPUInfo{GPUIndex: 1, UUID: "GPU-b"}},
+		},
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewGPUCollector(config, cache))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	// labels and value of the series of every metric, by gpu
+	series := make(map[string]map[string]map[string]string)
+	for _, mf := range mfs {
+		series[mf.GetName()] = make(map[string]map[string]string)
+		for _, m := range mf.Metric {
+			labels := make(map[string]string)
+			for _, lp := range m.Label {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			labels["value"] = fmt.Sprintf("%v", m.Gauge.GetValue())
+			series[mf.GetName()][labels["gpu"]] = labels
+		}
+	}
+
+	for _, name := range []string{GPU_UP, "nvml_gpu_up"} {
+		if len(series[name]) != 2 {
+			t.Errorf("%v has %d series, want 2", name, len(series[name]))
+		}
+		if series[name]["0"]["value"] != "1" || series[name]["1"]["value"] != "0" {
+			t.Errorf("%v: %v", name, series[name])
+		}
+		for _, labels := range series[name] {
+			if _, ok := labels[LabelReason]; ok {
+				t.Errorf("%v has the reason label", name)
+			}
+		}
+	}
+	for _, name := range []string{GPU_DOWN_INFO, "nvml_gpu_down_info"} {
+		if len(series[name]) != 1 {
+			t.Errorf("%v has %d series, want 1", name, len(series[name]))
+		}
+		if labels := series[name]["1"]; labels[LabelReason] != "GPU_IS_LOST" || labels["value"] != "1" {
+			t.Errorf("%v: %v", name, labels)
+		}
+	}
+	// the down gpu has no other metrics
+	if _, ok := series[GPU_TEMPERATURE]["1"]; ok || len(series[GPU_TEMPERATURE]) != 1 {
+		t.Errorf("%v: %v", GPU_TEMPERATURE, series[GPU_TEMPERATURE])
+	}
+}
+
+func TestSameDevices(t *testing.T) {
+	devices := func(handleError string) []GPUDevice {
+		return []GPUDevice{
+			{GPUInfo: GPUInfo{GPUIndex: 0, UUID: "GPU-a"}},
+			{GPUInfo: GPUInfo{GPUIndex: 1, UUID: "GPU-b"}, handleError: handleError},
+		}
+	}
+	if !sameDevices(devices(""), devices("")) {
+		t.Error("same devices differ")
+	}
+	if sameDevices(devices(""), devices("GPU_IS_LOST")) {
+		t.Error("a lost handle is not a change")
+	}
+	if sameDevices(devices(""), devices("")[:1]) {
+		t.Error("a removed gpu is not a change")
+	}
+	swapped := devices("")
+	swapped[0].UUID, swapped[1].UUID = swapped[1].UUID, swapped[0].UUID
+	if sameDevices(devices(""), swapped) {
+		t.Error("reordered gpus are not a change")
+	}
+}
+
+func TestAppendLostDevices(t *testing.T) {
+	previous := []GPUDevice{
+		{GPUInfo: GPUInfo{GPUIndex: 0, UUID: "GPU-a"}},
+		{GPUInfo: GPUInfo{GPUIndex: 1, UUID: "GPU-b"}},
+		{GPUInfo: GPUInfo{GPUIndex: 2, UUID: "GPU-c"}},
+	}
+	// GPU-b and GPU-c are gone, a new GPU-d took index 1
+	scanned := []GPUDevice{
+		{GPUInfo: GPUInfo{GPUIndex: 0, UUID: "GPU-a"}},
+		{GPUInfo: GPUInfo{GPUIndex: 1, UUID: "GPU-d"}},
+	}
+	lost := map[string]GPUDevice{"GPU-b": previous[1], "GPU-c": previous[2]}
+	devices := appendLostDevices(scanned, previous, lost)
+
+	want := []struct {
+		uuid        string
+		handleError string
+	}{
+		{"GPU-a", ""},
+		{"GPU-d", ""},
+		{"GPU-c", "NOT_FOUND"},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("%d devices, want %d", len(devices), len(want))
+	}
+	indexes := make(map[uint]bool)
+	for i, w := range want {
+		if devices[i].UUID != w.uuid || devices[i].handleError != w.handleError {
+			t.Errorf("device %d: %v %q, want %v %q", i, devices[i].UUID, devices[i].handleError, w.uuid, w.handleError)
+		}
+		if indexes[devices[i].GPUIndex] {
+			t.Errorf("index %d is shared", devices[i].GPUIndex)
+		}
+		indexes[devices[i].GPUIndex] = true
+	}
+}
@@ -18,7 +18,6 @@ package collector
 
 import (
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
@@ -29,11 +28,21 @@ import (
 type NVMLCache struct {
 	sync.RWMutex
 	DeviceCount  uint
-	DeviceInfos  []GPUDevice
+	DeviceInfos  []GPUDevice // written by the update loop only, under the lock
 	GPUStats     []GPUStat
 	ProcessStats map[string]ProcessStat
 	Hostname     string
 	config       *Config
+	// time the current snapshot was collected
+	LastUpdate time.Time
+
+	updateHooks      []func()
+	profilingBackend ProfilingBackend
+
+	driverVersion     string
+	cudaDriverVersion string
+	nvmlVersion       string
+	lastRescan        time.Time
 }
 
 func NewNVMLCache(config *Config) (*NVMLCache, error) {
@@ -42,53 +51,221 @@ func NewNVMLCache(config *Config) (*NVMLCache, error) {
 	ret := nvml.Init()
 
 	if ret != nvml.SUCCESS {
-		log.Fatalf("Unable to init NVML: %v", nvml.ErrorString(ret))
+		return nil, fmt.Errorf("unable to init NVML: %v", nvml.ErrorString(ret))
+	}
+
+	cache := &NVMLCache{
+		ProcessStats: make(map[string]ProcessStat),
+		Hostname:     config.HostName,
+		config:       config,
+	}
+	// 系统信息
+	cache.driverVersion, _ = nvml.SystemGetDriverVersion()
+	cache.nvmlVersion, _ = nvml.SystemGetNVMLVersion()
+	if v, ret := nvml.SystemGetCudaDriverVersion(); ret == nvml.SUCCESS {
+		cache.cudaDriverVersion = fmt.Sprintf("%d.%d", v/1000, v%1000/10)
+	}
+
+	// 初始化GPU设备信息
+	deviceInfos, err := cache.scanDevices()
+	if err != nil {
+		nvml.Shutdown()
+		return nil, err
 	}
+	cache.setDevices(deviceInfos)
+	cache.GPUStats = make([]GPUStat, 0, len(deviceInfos))
+	cache.lastRescan = time.Now()
+
+	return cache, nil
+}
 
+// newGPUDevice reads the static information of the device at nvml index i
+func (c *NVMLCache) newGPUDevice(i int, device nvml.Device) GPUDevice {
+	var gpu GPUDevice
+	gpu.Device = device
+	gpu.UUID, _ = device.GetUUID()
+	gpu.GPUIndex = uint(i)
+	gpu.GPUModelName, _ = device.GetName()
+	gpu.Attributes, _ = device.GetAttributes()
+	// gpu.Attributes = DeviceAttributes{
+	// 	MultiprocessorCount:       attr.MultiprocessorCount,
+	// 	SharedCopyEngineCount:     attr.SharedCopyEngineCount,
+	// 	SharedDecoderCount:        attr.SharedDecoderCount,
+	// 	SharedEncoderCount:        attr.SharedEncoderCount,
+	// 	SharedJpegCount:           attr.SharedJpegCount,
+	// 	SharedOfaCount:            attr.SharedOfaCount,
+	// 	GpuInstanceSliceCount:     attr.GpuInstanceSliceCount,
+	// 	ComputeInstanceSliceCount: attr.ComputeInstanceSliceCount,
+	// 	MemorySizeMB:              attr.MemorySizeMB,
+	// }
+	gpu.PcieLinkMaxSpeed, _ = device.GetPcieLinkMaxSpeed()
+	gpu.DriverVersion = c.driverVersion
+	gpu.CudaDriverVersion = c.cudaDriverVersion
+	gpu.NVMLVersion = c.nvmlVersion
+	gpu.DeviceGetGPUInfo()
+	return gpu
+}
+
+// scanDevices enumerates the GPUs. Known GPUs keep their info with a new handle,
+// GPUIndex stays the nvml index when GPUs are filtered out. A GPU whose handle
+// cannot be acquired, or that is not visible anymore, is kept down until a
+// later scan gets it or another GPU takes its index.
+func (c *NVMLCache) scanDevices() ([]GPUDevice, error) {
 	// 获取GPU数量
 	count, ret := nvml.DeviceGetCount()
 	if ret != nvml.SUCCESS {
-		log.Fatalf("Unable to get device count: %v", nvml.ErrorString(ret))
+		return nil, fmt.Errorf("unable to get device count: %v", nvml.ErrorString(ret))
 	}
 
-	// 初始化GPU设备信息
-	deviceInfos := make([]GPUDevice, count)
-
+	known := make(map[string]GPUDevice, len(c.DeviceInfos))
+	knownIndexes := make(map[uint]string, len(c.DeviceInfos))
+	for _, gpu := range c.DeviceInfos {
+		if gpu.UUID != "" {
+			known[gpu.UUID] = gpu
+			knownIndexes[gpu.GPUIndex] = gpu.UUID
+		}
+	}
+	deviceInfos := make([]GPUDevice, 0, count)
 	for i := 0; i < count; i++ {
 		device, ret := nvml.DeviceGetHandleByIndex(i)
 		if ret != nvml.SUCCESS {
-			log.Fatalf("Unable to get device at index %d: %v", i, nvml.ErrorString(ret))
+			logrus.Errorf("Unable to get device at index %d: %v", i, nvml.ErrorString(ret))
+			// a known gpu at this index keeps its info, e.g. when it is lost
+			if uuid, ok := knownIndexes[uint(i)]; ok {
+				if gpu, ok := known[uuid]; ok {
+					delete(known, uuid)
+					gpu.Device = nvml.Device{}
+					gpu.handleError = nvmlErrorName(ret)
+					deviceInfos = append(deviceInfos, gpu)
+					continue
+				}
+			}
+			if !selectsPlaceholder(c.config.GPUFilter, uint(i), c.DeviceInfos) {
+				continue
+			}
+			var gpu GPUDevice
+			gpu.GPUIndex = uint(i)
+			gpu.MinorNumber = -1
+			gpu.NUMANode = -1
+			gpu.handleError = nvmlErrorName(ret)
+			deviceInfos = append(deviceInfos, gpu)
+			continue
+		}
+		uuid, _ := device.GetUUID()
+		if gpu, ok := known[uuid]; ok {
+			delete(known, uuid)
+			gpu.Device = device
+			gpu.GPUIndex = uint(i)
+			gpu.handleError = ""
+			deviceInfos = append(deviceInfos, gpu)
+			continue
 		}
 
-		deviceInfos[i].Device = device
-		deviceInfos[i].UUID, _ = device.GetUUID()
-		deviceInfos[i].GPUIndex = uint(i)
-		deviceInfos[i].GPUModelName, _ = device.GetName()
-		deviceInfos[i].Attributes, _ = device.GetAttributes()
-		// deviceInfos[i].Attributes = DeviceAttributes{
-		// 	MultiprocessorCount:       attr.MultiprocessorCount,
-		// 	SharedCopyEngineCount:     attr.SharedCopyEngineCount,
-		// 	SharedDecoderCount:        attr.SharedDecoderCount,
-		// 	SharedEncoderCount:        attr.SharedEncoderCount,
-		// 	SharedJpegCount:           attr.SharedJpegCount,
-		// 	SharedOfaCount:            attr.SharedOfaCount,
-		// 	GpuInstanceSliceCount:     attr.GpuInstanceSliceCount,
-		// 	ComputeInstanceSliceCount: attr.ComputeInstanceSliceCount,
-		// 	MemorySizeMB:              attr.MemorySizeMB,
-		// }
-		deviceInfos[i].PcieLinkMaxSpeed, _ = device.GetPcieLinkMaxSpeed()
+		gpu := c.newGPUDevice(i, device)
+		if !c.config.GPUFilter.Selects(&gpu.GPUInfo) {
+			if c.DeviceInfos == nil {
+				logrus.Infof("gpu:%d %v %v is filtered out", gpu.GPUIndex, gpu.UUID, gpu.PCIBusID)
+			}
+			continue
+		}
+		if c.DeviceInfos != nil {
+			logrus.Infof("gpu:%d %v %v is new", gpu.GPUIndex, gpu.UUID, gpu.PCIBusID)
+		}
+		deviceInfos = append(deviceInfos, gpu)
 	}
+	return appendLostDevices(deviceInfos, c.DeviceInfos, known), nil
+}
 
-	cache := &NVMLCache{
-		DeviceInfos:  deviceInfos,
-		DeviceCount:  uint(count),
-		GPUStats:     make([]GPUStat, count),
-		ProcessStats: make(map[string]ProcessStat),
-		Hostname:     config.HostName,
-		config:       config,
+// selectsPlaceholder reports whether a GPU without handle is reported down. It
+// has no uuid, bus id or model, so unless its index was selected before, only
+// a filter on indexes can tell, otherwise an excluded GPU would show up.
+func selectsPlaceholder(filter *GPUFilter, index uint, previous []GPUDevice) bool {
+	for _, gpu := range previous {
+		if gpu.GPUIndex == index {
+			return true
+		}
 	}
+	if !filter.byIndex() {
+		return false
+	}
+	return filter.Selects(&GPUInfo{GPUIndex: index})
+}
 
-	return cache, nil
+// appendLostDevices keeps the previous devices that were not found by a scan
+// down, unless another GPU took their index: the index identifies the GPU in
+// the metrics and cannot be shared.
+func appendLostDevices(deviceInfos []GPUDevice, previous []GPUDevice, lost map[string]GPUDevice) []GPUDevice {
+	indexes := make(map[uint]string, len(deviceInfos))
+	for _, gpu := range deviceInfos {
+		indexes[gpu.GPUIndex] = gpu.UUID
+	}
+	for _, gpu := range previous {
+		if _, ok := lost[gpu.UUID]; !ok {
+			continue
+		}
+		if uuid, ok := indexes[gpu.GPUIndex]; ok {
+			logrus.Infof("gpu:%d %v is not visible anymore, its index is now %v", gpu.GPUIndex, gpu.UUID, uuid)
+			continue
+		}
+		gpu.Device = nvml.Device{}
+		gpu.handleError = nvmlErrorName(nvml.ERROR_NOT_FOUND)
+		indexes[gpu.GPUIndex] = gpu.UUID
+		deviceInfos = append(deviceInfos, gpu)
+	}
+	return deviceInfos
+}
+
+// setDevices probes the topology of the devices that have a handle and makes
+// them the devices of the cache
+func (c *NVMLCache) setDevices(deviceInfos []GPUDevice) {
+	up := make([]GPUDevice, 0, len(deviceInfos))
+	for _, gpu := range deviceInfos {
+		if gpu.handleError == "" {
+			up = append(up, gpu)
+		}
+	}
+	probeTopology(up)
+	for i, j := 0, 0; i < len(deviceInfos) && j < len(up); i++ {
+		if deviceInfos[i].handleError == "" {
+			deviceInfos[i] = up[j]
+			j++
+		}
+	}
+
+	c.Lock()
+	c.DeviceInfos = deviceInfos
+	c.DeviceCount = uint(len(deviceInfos))
+	c.Unlock()
+}
+
+// rescan picks up GPUs that changed, e.g. new, reattached or lost GPUs. Only
+// then is NVML restarted and are the GPUs scanned again, as the handles of a
+// lost GPU stay invalid.
+func (c *NVMLCache) rescan() {
+	c.lastRescan = time.Now()
+	deviceInfos, err := c.scanDevices()
+	if err == nil && sameDevices(deviceInfos, c.DeviceInfos) {
+		return
+	}
+	logrus.Infof("GPUs changed, restarting NVML to reacquire them...")
+	nvml.Shutdown()
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		logrus.Errorf("Unable to init NVML: %v", nvml.ErrorString(ret))
+		return
+	}
+	deviceInfos, err = c.scanDevices()
+	if err != nil {
+		logrus.Errorf("Failed to rescan gpus, err: %v", err)
+		return
+	}
+	if sameDevices(deviceInfos, c.DeviceInfos) {
+		// the handles are new after the restart
+		c.Lock()
+		c.DeviceInfos = deviceInfos
+		c.Unlock()
+		return
+	}
+	c.setDevices(deviceInfos)
 }
 
 func (c *NVMLCache) Run(stop chan interface{}) {
@@ -102,6 +279,10 @@ func (c *NVMLCache) Run(stop chan interface{}) {
 			logrus.Infof("Shutdown nvml cache...")
 			return
 		case <-t.C:
+			rescanInterval := time.Second * time.Duration(c.config.RescanInterval)
+			if rescanInterval > 0 && time.Since(c.lastRescan) >= rescanInterval {
+				c.rescan()
+			}
 			err := c.udpateCache()
 			// logrus.Infof("Updating nvml cache...")
 			if err != nil {
@@ -118,19 +299,34 @@ func (c *NVMLCache) udpateCache() error {
 	start := time.Now()
 	newProcStat := make(map[string]ProcessStat)
 	newGPUStat := make([]GPUStat, c.DeviceCount)
+	wasUp := make(map[string]bool, len(c.GPUStats))
+	for _, gpu := range c.GPUStats {
+		wasUp[gpu.UUID] = gpu.Up
+	}
 	for i, devcie := range c.DeviceInfos {
+		gpuLabel := devcie.GPULabel(c.config.GPULabel)
+		if reason := devcie.health(); reason != "" {
+			if up, ok := wasUp[devcie.UUID]; up || !ok {
+				logrus.Errorf("gpu:%d %v is down: %v", devcie.GPUIndex, devcie.UUID, reason)
+			}
+			newGPUStat[i] = devcie.downStat(reason)
+			newGPUStat[i].GPULabel = gpuLabel
+			continue
+		}
 		// fixme: pcie带宽获取速度很慢
 		// 更新GPUStat
 		// s := time.Now()
 		newGPUStat[i] = devcie.DeviceGetGPUStat(SupportedGGPUMetricsName)
+		newGPUStat[i].GPULabel = gpuLabel
 		// logrus.Infof("get gpu stat time: %v", time.Since(s))
 		// 更新ProcStat
 		// s = time.Now()
-		psStats := devcie.GetProcessStat(c.config.UseSlurm)
+		psStats := devcie.GetProcessStat(c.config.UseSlurm, c.config.Redaction)
 		for _, ps := range psStats {
+			ps.GPULabel = gpuLabel
 			pid := fmt.Sprintf("%d", ps.Pid)
 			if _, ok := newProcStat[pid]; ok {
-				pid = fmt.Sprintf("%d-%d", ps.Pid, i)
+				pid = fmt.Sprintf("%d-%d", ps.Pid, devcie.GPUIndex)
 			}
 			newProcStat[pid] = ps
 		}
@@ -149,7 +345,7 @@ func (c *NVMLCache) udpateCache() error {
 	// 		newGPUStat[i] = device.DeviceGetGPUStat(SupportedGGPUMetricsName)
 
 	// 		// 更新 ProcStat
-	// 		psStats := device.GetProcessStat(c.config.UseSlurm)
+	// 		psStats := device.GetProcessStat(c.config.UseSlurm, c.config.Redaction)
 	// 		procStatCh <- psStats
 	// 	}(i, device)
 	// }
@@ -167,14 +363,64 @@ func (c *NVMLCache) udpateCache() error {
 	// 	}
 	// }
 
+	c.updateProfiling(newGPUStat)
+
+	// integrate the pcie throughput samples into byte counters
+	c.integratePcieBytes(start, newGPUStat)
+
 	c.Lock()
 	c.GPUStats = newGPUStat
 	c.ProcessStats = newProcStat
+	c.LastUpdate = start
 	c.Unlock()
 	logrus.Debugf("udpate nvml cache time: %v", time.Since(start))
+
+	for _, hook := range c.updateHooks {
+		hook()
+	}
 	return nil
 }
 
+// integratePcieBytes adds the bytes transferred since the last update, using the
+// mean of the previous and current throughput over the interval. Counters start
+// at 0 when the exporter starts.
+func (c *NVMLCache) integratePcieBytes(now time.Time, newGPUStat []GPUStat) {
+	if c.LastUpdate.IsZero() {
+		return
+	}
+	interval := now.Sub(c.LastUpdate).Seconds()
+	prevStats := make(map[string]GPUStat, len(c.GPUStats))
+	for _, prev := range c.GPUStats {
+		prevStats[prev.UUID] = prev
+	}
+	for i := range newGPUStat {
+		prev, ok := prevStats[newGPUStat[i].UUID]
+		if !ok {
+			continue
+		}
+		if !newGPUStat[i].Up {
+			newGPUStat[i].PCIETXBytesTotal = prev.PCIETXBytesTotal
+			newGPUStat[i].PCIERXBytesTotal = prev.PCIERXBytesTotal
+			continue
+		}
+		newGPUStat[i].PCIETXBytesTotal = prev.PCIETXBytesTotal +
+			float64(prev.PCIETXBytes+newGPUStat[i].PCIETXBytes)/2*interval
+		newGPUStat[i].PCIERXBytesTotal = prev.PCIERXBytesTotal +
+			float64(prev.PCIERXBytes+newGPUStat[i].PCIERXBytes)/2*interval
+	}
+}
+
+// Update refreshes the cache once, used by one-shot modes that do not call Run
+func (c *NVMLCache) Update() error {
+	return c.udpateCache()
+}
+
+// AddUpdateHook registers f to be called after every cache update.
+// Hooks must be added before Run is started.
+func (c *NVMLCache) AddUpdateHook(f func()) {
+	c.updateHooks = append(c.updateHooks, f)
+}
+
 // get cache snapshot
 func (c *NVMLCache) GetProcessStats() map[string]ProcessStat {
 	snapshot := make(map[string]ProcessStat)
@@ -188,15 +434,23 @@ func (c *NVMLCache) GetProcessStats() map[string]ProcessStat {
 
 // get cache snapshot
 func (c *NVMLCache) GetGPUStats() []GPUStat {
-	snapshot := make([]GPUStat, c.DeviceCount)
 	c.Lock()
+	snapshot := make([]GPUStat, len(c.GPUStats))
 	copy(snapshot, c.GPUStats)
 	c.Unlock()
 	return snapshot
 }
 
+func (c *NVMLCache) GetLastUpdate() time.Time {
+	c.RLock()
+	defer c.RUnlock()
+	return c.LastUpdate
+}
+
 func (c *NVMLCache) GetGPUInfos() []GPUInfo {
-	snapshot := make([]GPUInfo, c.DeviceCount)
+	c.RLock()
+	defer c.RUnlock()
+	snapshot := make([]GPUInfo, len(c.DeviceInfos))
 
 	for i, d := range c.DeviceInfos {
 		snapshot[i] = d.GPUInfo
@@ -2,6 +2,8 @@ package collector
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -11,7 +13,7 @@ var (
 	ProcessInfoLables         = []string{"gpu", "pid", "procName", "user", "status", "ppid", "workDir", "cmdLine"}
 	getProcessStatLabelValues = func(ps ProcessStat) []string {
 		return []string{
-			fmt.Sprintf("%d", ps.GPUIndex),
+			ps.GPULabel,
 			fmt.Sprintf("%d", ps.Pid),
 			ps.ProcName,
 			ps.User,
@@ -29,18 +31,31 @@ var (
 		PROCESS_GPU_MEM_UTIL,
 		PROCESS_GPU_DECODE_UTIL,
 		PROCESS_GPU_ENCODE_UTIL,
+		PROCESS_GPU_ENCODER_SESSIONS,
+		PROCESS_GPU_NUMA_MISMATCH,
 	}
 )
 
 type ProcessCollector struct {
 	cache              *NVMLCache
-	metricDescs        map[string]*prometheus.Desc
+	metricDescs        map[string]*metricDesc
 	funcGetLabelValues func(ps ProcessStat) []string
 	config             *Config
+
+	// NamingV2 and NamingBoth, keyed by legacy name like metricDescs
+	v2Descs map[string]*metricDesc
+
+	// nil without maxProcessSeries
+	droppedDesc  *metricDesc
+	overflowDesc *metricDesc
+	// overflows are counted once per cache update, however often it is gathered
+	overflowLock   sync.Mutex
+	overflowTotal  uint64
+	overflowUpdate time.Time
 }
 
 func NewProcessCollector(config *Config, cache *NVMLCache) *ProcessCollector {
-	metricsMap := make(map[string]*prometheus.Desc)
+	metricsMap := make(map[string]*metricDesc)
 	if len(config.SupportedMetrics) > 0 {
 		SupportedProcessMetricsName = []string{}
 		for _, name := range config.SupportedMetrics {
@@ -50,93 +65,152 @@ func NewProcessCollector(config *Config, cache *NVMLCache) *ProcessCollector {
 		}
 	}
 
+	v2Descs := make(map[string]*metricDesc)
 	for _, name := range SupportedProcessMetricsName {
-		if !config.UseSlurm {
-			if name == PROCESS_INFO {
-				metricsMap[name] = prometheus.NewDesc(
-					name,
-					METRIC_META_MAP[name].Help,
-					ProcessInfoLables,
-					prometheus.Labels{LabelHostName: config.HostName},
-				)
-			} else {
-				metricsMap[name] = prometheus.NewDesc(
-					name,
-					METRIC_META_MAP[name].Help,
-					ProcessLabels,
-					prometheus.Labels{LabelHostName: config.HostName},
-				)
-			}
-
-		} else {
-			// slurm添加的SlurmProcLabels
-			if name == PROCESS_INFO {
-				metricsMap[name] = prometheus.NewDesc(
-					name,
-					METRIC_META_MAP[name].Help,
-					SlurmProcInfoLabels,
-					prometheus.Labels{LabelHostName: config.HostName},
-				)
+		var labels []string
+		switch config.Cardinality.AggregateBy {
+		case AggregateByUser:
+			labels = ProcessUserLabels
+		case AggregateByJob:
+			labels = ProcessJobLabels
+		default:
+			if !config.UseSlurm {
+				if name == PROCESS_INFO {
+					labels = ProcessInfoLables
+				} else {
+					labels = ProcessLabels
+				}
 			} else {
-				metricsMap[name] = prometheus.NewDesc(
-					name,
-					METRIC_META_MAP[name].Help,
-					SlurmProcLabels,
-					prometheus.Labels{LabelHostName: config.HostName},
-				)
+				// slurm添加的SlurmProcLabels
+				if name == PROCESS_INFO {
+					labels = SlurmProcInfoLabels
+				} else {
+					labels = SlurmProcLabels
+				}
 			}
-
+		}
+		if config.legacyNames() {
+			metricsMap[name] = newMetricDesc(
+				config,
+				name,
+				METRIC_META_MAP[name].Help,
+				labels,
+				prometheus.Labels{LabelHostName: config.HostName},
+			)
+		}
+		if v2, ok := METRIC_V2_META_MAP[name]; ok && config.v2Names() {
+			v2Descs[name] = newMetricDesc(
+				config,
+				v2.Name,
+				v2.Help,
+				labels,
+				prometheus.Labels{LabelHostName: config.HostName},
+			)
 		}
 	}
 	psCollector := &ProcessCollector{
 		metricDescs: metricsMap,
+		v2Descs:     v2Descs,
 		cache:       cache,
 		config:      config,
 	}
 	// slurm相关添加的labels
-	if config.UseSlurm {
+	switch {
+	case config.Cardinality.AggregateBy == AggregateByUser:
+		psCollector.funcGetLabelValues = getProcessUserLabelValues
+	case config.Cardinality.AggregateBy == AggregateByJob:
+		psCollector.funcGetLabelValues = getProcessJobLabelValues
+	case config.UseSlurm:
 		psCollector.funcGetLabelValues = getSlurmProcessStatLabelValues
-	} else {
+	default:
 		psCollector.funcGetLabelValues = getProcessStatLabelValues
 	}
+	if config.Cardinality.MaxProcessSeries > 0 {
+		psCollector.droppedDesc = newMetricDesc(
+			config,
+			PROCESS_SERIES_DROPPED,
+			"Process series dropped in the last collect cycle because of maxProcessSeries.",
+			nil,
+			prometheus.Labels{LabelHostName: config.HostName},
+		)
+		psCollector.overflowDesc = newMetricDesc(
+			config,
+			PROCESS_SERIES_OVERFLOW_TOTAL,
+			"Collect cycles with more processes than maxProcessSeries.",
+			nil,
+			prometheus.Labels{LabelHostName: config.HostName},
+		)
+	}
 
 	return psCollector
 }
 
 func (c *ProcessCollector) Describe(ch chan<- *prometheus.Desc) {
 	for _, desc := range c.metricDescs {
-		ch <- desc
+		ch <- desc.Desc
+	}
+	for _, desc := range c.v2Descs {
+		ch <- desc.Desc
+	}
+	if c.droppedDesc != nil {
+		ch <- c.droppedDesc.Desc
+		ch <- c.overflowDesc.Desc
 	}
 }
 
 func (c *ProcessCollector) Collect(ch chan<- prometheus.Metric) {
+	lastUpdate := c.cache.GetLastUpdate()
 	processCache := c.cache.GetProcessStats()
+	groups, dropped := c.groupProcesses(processCache)
 	for metricName, desc := range c.metricDescs {
-		for _, ps := range processCache {
-			value := ps.GetValueFromMetricName(metricName)
-			var metric prometheus.Metric
-			labelValues := c.funcGetLabelValues(ps)
+		c.collectMetric(ch, metricName, desc, 1, groups)
+	}
+	for metricName, desc := range c.v2Descs {
+		c.collectMetric(ch, metricName, desc, METRIC_V2_META_MAP[metricName].Scale, groups)
+	}
+	if c.droppedDesc != nil {
+		c.overflowLock.Lock()
+		if dropped > 0 && !lastUpdate.Equal(c.overflowUpdate) {
+			c.overflowTotal++
+			c.overflowUpdate = lastUpdate
+		}
+		overflowTotal := c.overflowTotal
+		c.overflowLock.Unlock()
+		series := dropped * (len(c.metricDescs) + len(c.v2Descs))
+		ch <- c.droppedDesc.mustNewConstMetric(prometheus.GaugeValue, float64(series))
+		ch <- c.overflowDesc.mustNewConstMetric(prometheus.CounterValue, float64(overflowTotal))
+	}
+}
 
-			if metricName == PROCESS_INFO {
-				labelValues = append(labelValues, ps.WorkingDir, ps.CommandLine)
-				metric = prometheus.MustNewConstMetric(
-					desc,
-					METRIC_META_MAP[metricName].PromType,
-					value,
-					labelValues...,
-				)
-			} else {
-				metric = prometheus.MustNewConstMetric(
-					desc,
-					METRIC_META_MAP[metricName].PromType,
-					value,
-					labelValues...,
-				)
-			}
+// collectMetric sends the series of metricName of every process group to desc,
+// values are multiplied by scale
+func (c *ProcessCollector) collectMetric(ch chan<- prometheus.Metric, metricName string, desc *metricDesc,
+	scale float64, groups []*processGroup) {
+	cardinality := &c.config.Cardinality
+	for _, g := range groups {
+		value := g.value(metricName) * scale
+		var metric prometheus.Metric
+		labelValues := append([]string{}, g.labelValues...)
 
-			if metric != nil {
-				ch <- metric
-			}
+		if metricName == PROCESS_INFO && cardinality.AggregateBy == "" {
+			ps := g.processes[0]
+			workDir, cmdLine := cardinality.ProcessInfoValues(&ps)
+			labelValues = append(labelValues, workDir, cmdLine)
+			metric = desc.mustNewConstMetric(
+				METRIC_META_MAP[metricName].PromType,
+				value,
+				labelValues...,
+			)
+		} else {
+			metric = desc.mustNewConstMetric(
+				METRIC_META_MAP[metricName].PromType,
+				value,
+				labelValues...,
+			)
+		}
+
+		if metric != nil {
+			ch <- metric
 		}
 	}
 }
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Sources of a profiling value, exported as the source label
+const (
+	ProfilingSourceDCGM = "dcgm"
+	ProfilingSourceNVML = "nvml"
+)
+
+// ProfilingValue is one profiling metric of a GPU and where it came from
+type ProfilingValue struct {
+	Value  float64 `json:"value"`
+	Source string  `json:"source"`
+}
+
+// ProfilingBackend reads DCGM profiling fields, e.g. from a DCGM host engine.
+// Values are in the DCGM units: ratios in 0-1, throughput in B/s. Fields the
+// GPU does not support are left out of the result.
+type ProfilingBackend interface {
+	GetProfilingValues(uuid string, fields []string) (map[string]float64, error)
+}
+
+// DCGM_PROFILING_FIELDS maps the profiling metrics to their DCGM field
+var DCGM_PROFILING_FIELDS = map[string]string{
+	GPU_PROF_GR_ENGINE_ACTIVE: "DCGM_FI_PROF_GR_ENGINE_ACTIVE",
+	GPU_PROF_SM_ACTIVE:        "DCGM_FI_PROF_SM_ACTIVE",
+	GPU_PROF_SM_OCCUPANCY:     "DCGM_FI_PROF_SM_OCCUPANCY",
+	GPU_PROF_TENSOR_ACTIVE:    "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE",
+	GPU_PROF_DRAM_ACTIVE:      "DCGM_FI_PROF_DRAM_ACTIVE",
+	GPU_PROF_FP64_ACTIVE:      "DCGM_FI_PROF_PIPE_FP64_ACTIVE",
+	GPU_PROF_FP32_ACTIVE:      "DCGM_FI_PROF_PIPE_FP32_ACTIVE",
+	GPU_PROF_FP16_ACTIVE:      "DCGM_FI_PROF_PIPE_FP16_ACTIVE",
+	GPU_PROF_PCIE_TX_BYTES:    "DCGM_FI_PROF_PCIE_TX_BYTES",
+	GPU_PROF_PCIE_RX_BYTES:    "DCGM_FI_PROF_PCIE_RX_BYTES",
+	GPU_PROF_NVLINK_TX_BYTES:  "DCGM_FI_PROF_NVLINK_TX_BYTES",
+	GPU_PROF_NVLINK_RX_BYTES:  "DCGM_FI_PROF_NVLINK_RX_BYTES",
+}
+
+func IsProfilingMetric(metricName string) bool {
+	_, ok := DCGM_PROFILING_FIELDS[metricName]
+	return ok
+}
+
+// setProfiling records a profiling value, replacing the previous one
+func (gpu *GPUStat) setProfiling(metricName string, value float64, source string) {
+	if gpu.Profiling == nil {
+		gpu.Profiling = make(map[string]ProfilingValue)
+	}
+	gpu.Profiling[metricName] = ProfilingValue{Value: value, Source: source}
+}
+
+// SetProfilingBackend makes the cache read the profiling metrics from backend,
+// it must be called before Run is started. Without a backend, or when it fails,
+// the metrics NVML can estimate are kept and the others are omitted.
+func (c *NVMLCache) SetProfilingBackend(backend ProfilingBackend) {
+	c.profilingBackend = backend
+}
+
+// updateProfiling overrides the NVML estimates with the values of the backend
+func (c *NVMLCache) updateProfiling(newGPUStat []GPUStat) {
+	if c.profilingBackend == nil {
+		return
+	}
+	metrics := make([]string, 0, len(DCGM_PROFILING_FIELDS))
+	fields := make([]string, 0, len(DCGM_PROFILING_FIELDS))
+	for _, metric := range SupportedGGPUMetricsName {
+		if field, ok := DCGM_PROFILING_FIELDS[metric]; ok {
+			metrics = append(metrics, metric)
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+	for i := range newGPUStat {
+		if !newGPUStat[i].Up {
+			continue
+		}
+		values, err := c.profilingBackend.GetProfilingValues(newGPUStat[i].UUID, fields)
+		if err != nil {
+			logrus.Warnf("cannot get profiling metrics of gpu:%v from dcgm, using nvml, err: %v", newGPUStat[i].GPUIndex, err)
+			continue
+		}
+		for j, field := range fields {
+			if value, ok := values[field]; ok {
+				newGPUStat[i].setProfiling(metrics[j], value, ProfilingSourceDCGM)
+			}
+		}
+	}
+}
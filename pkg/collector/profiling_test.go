@@ -0,0 +1,97 @@
+package collector_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+	"github.com/nvml-exporter/pkg/dcgm"
+)
+
+// nvmlStat is a GPU with the profiling estimates of NVML
+func nvmlStat() collector.GPUStat {
+	return collector.GPUStat{
+		UUID: "GPU-a",
+		Up:   true,
+		Profiling: map[string]collector.ProfilingValue{
+			collector.GPU_PROF_GR_ENGINE_ACTIVE: {Value: 0.5, Source: collector.ProfilingSourceNVML},
+			collector.GPU_PROF_DRAM_ACTIVE:      {Value: 0.2, Source: collector.ProfilingSourceNVML},
+		},
+	}
+}
+
+func TestUpdateProfiling(t *testing.T) {
+	engine := dcgm.NewFakeHostEngine()
+	engine.Set("GPU-a", "DCGM_FI_PROF_GR_ENGINE_ACTIVE", 0.75)
+	engine.Set("GPU-a", "DCGM_FI_PROF_PIPE_TENSOR_ACTIVE", 0.3)
+	backend, err := dcgm.NewBackend(engine, time.Second, collector.SupportedGGPUMetricsName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &collector.NVMLCache{}
+	cache.SetProfilingBackend(backend)
+
+	tests := []struct {
+		name   string
+		err    error
+		want   map[string]collector.ProfilingValue
+		absent []string
+	}{
+		{
+			name: "dcgm overrides nvml",
+			want: map[string]collector.ProfilingValue{
+				collector.GPU_PROF_GR_ENGINE_ACTIVE: {Value: 0.75, Source: collector.ProfilingSourceDCGM},
+				collector.GPU_PROF_TENSOR_ACTIVE:    {Value: 0.3, Source: collector.ProfilingSourceDCGM},
+				// not sampled by dcgm, the nvml estimate stays
+				collector.GPU_PROF_DRAM_ACTIVE: {Value: 0.2, Source: collector.ProfilingSourceNVML},
+			},
+			absent: []string{collector.GPU_PROF_SM_ACTIVE, collector.GPU_PROF_FP64_ACTIVE},
+		},
+		{
+			name: "dcgm error keeps nvml",
+			err:  errors.New("host engine went away"),
+			want: map[string]collector.ProfilingValue{
+				collector.GPU_PROF_GR_ENGINE_ACTIVE: {Value: 0.5, Source: collector.ProfilingSourceNVML},
+				collector.GPU_PROF_DRAM_ACTIVE:      {Value: 0.2, Source: collector.ProfilingSourceNVML},
+			},
+			absent: []string{collector.GPU_PROF_TENSOR_ACTIVE},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine.Lock()
+			engine.Err = tt.err
+			engine.Unlock()
+			stats := []collector.GPUStat{nvmlStat()}
+			cache.UpdateProfiling(stats)
+			for metric, want := range tt.want {
+				if got := stats[0].Profiling[metric]; got != want {
+					t.Errorf("%v: %+v, want %+v", metric, got, want)
+				}
+			}
+			for _, metric := range tt.absent {
+				if got, ok := stats[0].Profiling[metric]; ok {
+					t.Errorf("%v: %+v, want it omitted", metric, got)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateProfilingSkipsDownGPUs(t *testing.T) {
+	engine := dcgm.NewFakeHostEngine()
+	engine.Set("GPU-a", "DCGM_FI_PROF_GR_ENGINE_ACTIVE", 0.75)
+	backend, err := dcgm.NewBackend(engine, time.Second, collector.SupportedGGPUMetricsName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &collector.NVMLCache{}
+	cache.SetProfilingBackend(backend)
+
+	stats := []collector.GPUStat{{UUID: "GPU-a", Error: "GPU_IS_LOST"}}
+	cache.UpdateProfiling(stats)
+	if len(stats[0].Profiling) != 0 {
+		t.Errorf("down gpu has profiling values %+v", stats[0].Profiling)
+	}
+}
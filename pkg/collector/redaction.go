@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const redactedValue = "***"
+
+// RedactionConfig is the `redaction` section of the metric config file. It is
+// applied in UpdateProcessInfoCPU, so redacted values never reach the metrics,
+// /debug/process, job reports or sinks.
+type RedactionConfig struct {
+	// matches in the command line and slurm job name are replaced by ***, with
+	// capture groups only the groups are, e.g. (?i)--password[= ](\S+)
+	Patterns []string `yaml:"patterns"`
+	// users whose processes are shown as is
+	AllowUsers []string `yaml:"allowUsers"`
+	// replace the command line by the basename of the executable
+	BasenameOnly bool `yaml:"basenameOnly"`
+	// hide the working directory
+	HideWorkDir bool `yaml:"hideWorkDir"`
+
+	patterns []*regexp.Regexp
+}
+
+// Compile compiles the patterns, it must be called before the config is used
+func (rc *RedactionConfig) Compile() error {
+	rc.patterns = make([]*regexp.Regexp, 0, len(rc.Patterns))
+	for _, pattern := range rc.Patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid redaction pattern %q, err: %v", pattern, err)
+		}
+		rc.patterns = append(rc.patterns, regex)
+	}
+	return nil
+}
+
+// redactProcess redacts the command line, working directory and slurm job name
+// of ps, unless its user is allowed
+func (rc *RedactionConfig) redactProcess(ps *ProcessStat) {
+	if rc == nil || contains(rc.AllowUsers, ps.User) {
+		return
+	}
+	if rc.BasenameOnly {
+		ps.CommandLine = executableBasename(ps.CommandLine)
+	} else {
+		ps.CommandLine = rc.redact(ps.CommandLine)
+	}
+	if rc.HideWorkDir && ps.WorkingDir != "" {
+		ps.WorkingDir = redactedValue
+	}
+	ps.SlurmJobName = rc.redact(ps.SlurmJobName)
+}
+
+// redact replaces the matches of the patterns in value
+func (rc *RedactionConfig) redact(value string) string {
+	for _, regex := range rc.patterns {
+		matches := regex.FindAllStringSubmatchIndex(value, -1)
+		if matches == nil {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, match := range matches {
+			// the whole match, or every capture group
+			spans := [][2]int{{match[0], match[1]}}
+			if len(match) > 2 {
+				spans = spans[:0]
+				for i := 2; i+1 < len(match); i += 2 {
+					if match[i] >= 0 {
+						spans = append(spans, [2]int{match[i], match[i+1]})
+					}
+				}
+			}
+			for _, span := range spans {
+				if span[0] < last {
+					continue
+				}
+				b.WriteString(value[last:span[0]])
+				b.WriteString(redactedValue)
+				last = span[1]
+			}
+		}
+		b.WriteString(value[last:])
+		value = b.String()
+	}
+	return value
+}
+
+// executableBasename returns the basename of the first word of a command line
+func executableBasename(cmdLine string) string {
+	fields := strings.Fields(cmdLine)
+	if len(fields) == 0 {
+		return ""
+	}
+	return filepath.Base(fields[0])
+}
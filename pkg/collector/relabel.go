@@ -0,0 +1,271 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// LabelConfig is the `labels` section of the metric config file. It is applied
+// to every metric of the collectors in this order: relabel, drop, rename, static.
+type LabelConfig struct {
+	Static  map[string]string `yaml:"static"` // e.g. cluster, rack, partition
+	Rename  map[string]string `yaml:"rename"` // old name: new name, e.g. Hostname: instance
+	Drop    []string          `yaml:"drop"`
+	Relabel []RelabelRule     `yaml:"relabel"`
+}
+
+// RelabelRule is the replace action of Prometheus metric_relabel_configs: the
+// values of SourceLabels joined by Separator are matched against Regex, on a
+// match TargetLabel is set to Replacement with $1... expanded. Rules only apply
+// to metrics that have all SourceLabels.
+type RelabelRule struct {
+	SourceLabels []string `yaml:"sourceLabels"`
+	Separator    string   `yaml:"separator"`   // default ;
+	Regex        string   `yaml:"regex"`       // default (.*), anchored
+	TargetLabel  string   `yaml:"targetLabel"` // default the only source label
+	Replacement  string   `yaml:"replacement"` // default $1
+
+	regex *regexp.Regexp
+}
+
+// seriesLabels tell apart the series of a metric, dropping or overwriting them
+// makes several series collide and the scrape fail
+func seriesLabels() []string {
+	labels := []string{"gpu", "pid", "peerGPU"}
+	for _, extra := range METRIC_EXTRA_LABELS {
+		for _, label := range extra {
+			if !contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
+
+// collectorLabels are the labels of every metric of the collectors
+func collectorLabels() []string {
+	labels := []string{LabelHostName}
+	lists := [][]string{
+		GPUInfoLabels, GPUNUMAInfoLabels, GPUTopologyInfoLabels, DCGMLabels,
+		ProcessInfoLables, SlurmProcInfoLabels, ProcessUserLabels, ProcessJobLabels,
+		seriesLabels(),
+	}
+	for field := range dcgmLabelFields {
+		lists = append(lists, []string{field})
+	}
+	for _, list := range lists {
+		for _, label := range list {
+			if !contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels
+}
+
+// Compile checks the label names, compiles the regexes and fills the defaults,
+// it must be called before the config is used by the collectors. It rejects
+// configs that would make series collide: dropping or overwriting the labels
+// that tell series apart, or renaming or adding a label onto one that exists.
+func (lc *LabelConfig) Compile() error {
+	series := seriesLabels()
+	// the labels left once renamed and dropped ones are gone
+	remaining := make([]string, 0)
+	for _, label := range collectorLabels() {
+		if _, ok := lc.Rename[label]; !ok && !contains(lc.Drop, label) {
+			remaining = append(remaining, label)
+		}
+	}
+	for _, label := range lc.Drop {
+		if contains(series, label) {
+			return fmt.Errorf("cannot drop label %v, it tells series apart", label)
+		}
+	}
+	renamedTo := make(map[string]string, len(lc.Rename))
+	for from, to := range lc.Rename {
+		if !labelNameRE.MatchString(to) {
+			return fmt.Errorf("invalid label name %q to rename %v to", to, from)
+		}
+		if contains(remaining, to) {
+			return fmt.Errorf("cannot rename %v to %v, the label exists", from, to)
+		}
+		if other, ok := renamedTo[to]; ok {
+			return fmt.Errorf("cannot rename both %v and %v to %v", other, from, to)
+		}
+		renamedTo[to] = from
+	}
+	for name := range lc.Static {
+		if !labelNameRE.MatchString(name) {
+			return fmt.Errorf("invalid static label name %q", name)
+		}
+		if _, ok := renamedTo[name]; ok || contains(remaining, name) {
+			return fmt.Errorf("static label %v overwrites an existing label", name)
+		}
+	}
+	for i := range lc.Relabel {
+		rule := &lc.Relabel[i]
+		if len(rule.SourceLabels) == 0 {
+			return fmt.Errorf("relabel rule %d: sourceLabels is empty", i)
+		}
+		if rule.TargetLabel == "" {
+			if len(rule.SourceLabels) != 1 {
+				return fmt.Errorf("relabel rule %d: targetLabel is required with more than one source label", i)
+			}
+			rule.TargetLabel = rule.SourceLabels[0]
+		}
+		if !labelNameRE.MatchString(rule.TargetLabel) {
+			return fmt.Errorf("relabel rule %d: invalid targetLabel %q", i, rule.TargetLabel)
+		}
+		if contains(series, rule.TargetLabel) {
+			return fmt.Errorf("relabel rule %d: cannot overwrite %v, it tells series apart, use a new targetLabel", i, rule.TargetLabel)
+		}
+		if rule.Separator == "" {
+			rule.Separator = ";"
+		}
+		if rule.Regex == "" {
+			rule.Regex = "(.*)"
+		}
+		if rule.Replacement == "" {
+			rule.Replacement = "$1"
+		}
+		regex, err := regexp.Compile("^(?:" + rule.Regex + ")$")
+		if err != nil {
+			return fmt.Errorf("relabel rule %d: invalid regex, err: %v", i, err)
+		}
+		rule.regex = regex
+	}
+	return nil
+}
+
+// metricDesc is the desc of a metric after relabeling, label values passed to
+// mustNewConstMetric are those of the labels the desc was created with.
+type metricDesc struct {
+	*prometheus.Desc
+
+	// nil without relabeling
+	labels      *LabelConfig
+	inputNames  []string // variable labels then const labels
+	constValues []string
+	outputNames []string
+	rules       []*RelabelRule // the rules that apply to inputNames
+}
+
+// newMetricDesc creates the desc of a metric, applying config.Labels to its
+// labels. Const labels become variable labels when relabeling.
+func newMetricDesc(config *Config, name string, help string, labels []string, constLabels prometheus.Labels) *metricDesc {
+	lc := config.Labels
+	if lc == nil {
+		return &metricDesc{Desc: prometheus.NewDesc(name, help, labels, constLabels)}
+	}
+	d := &metricDesc{labels: lc}
+	d.inputNames = append(d.inputNames, labels...)
+	for label, value := range constLabels {
+		d.inputNames = append(d.inputNames, label)
+		d.constValues = append(d.constValues, value)
+	}
+
+	names := append([]string{}, d.inputNames...)
+	for i := range lc.Relabel {
+		rule := &lc.Relabel[i]
+		if !containsAll(names, rule.SourceLabels) {
+			continue
+		}
+		d.rules = append(d.rules, rule)
+		if !contains(names, rule.TargetLabel) {
+			names = append(names, rule.TargetLabel)
+		}
+	}
+	for _, label := range names {
+		if contains(lc.Drop, label) {
+			continue
+		}
+		if to, ok := lc.Rename[label]; ok {
+			label = to
+		}
+		if !contains(d.outputNames, label) {
+			d.outputNames = append(d.outputNames, label)
+		}
+	}
+	for label := range lc.Static {
+		if !contains(d.outputNames, label) {
+			d.outputNames = append(d.outputNames, label)
+		}
+	}
+	d.Desc = prometheus.NewDesc(name, help, d.outputNames, nil)
+	return d
+}
+
+// mustNewConstMetric is prometheus.MustNewConstMetric with relabeling
+func (d *metricDesc) mustNewConstMetric(valueType prometheus.ValueType, value float64, labelValues ...string) prometheus.Metric {
+	if d.labels == nil {
+		return prometheus.MustNewConstMetric(d.Desc, valueType, value, labelValues...)
+	}
+	return prometheus.MustNewConstMetric(d.Desc, valueType, value, d.relabel(labelValues)...)
+}
+
+func (d *metricDesc) relabel(labelValues []string) []string {
+	values := make(map[string]string, len(d.outputNames))
+	for i, label := range d.inputNames {
+		if i < len(labelValues) {
+			values[label] = labelValues[i]
+		} else if j := i - len(labelValues); j < len(d.constValues) {
+			values[label] = d.constValues[j]
+		}
+	}
+	for _, rule := range d.rules {
+		source := ""
+		for i, label := range rule.SourceLabels {
+			if i > 0 {
+				source += rule.Separator
+			}
+			source += values[label]
+		}
+		match := rule.regex.FindStringSubmatchIndex(source)
+		if match == nil {
+			continue
+		}
+		values[rule.TargetLabel] = string(rule.regex.ExpandString(nil, rule.Replacement, source, match))
+	}
+	// a renamed label replaces the label it is renamed to
+	renamed := make(map[string]string, len(values))
+	for label, value := range values {
+		if _, ok := d.labels.Rename[label]; !ok {
+			renamed[label] = value
+		}
+	}
+	for from, to := range d.labels.Rename {
+		if value, ok := values[from]; ok && !contains(d.labels.Drop, from) {
+			renamed[to] = value
+		}
+	}
+	for label, value := range d.labels.Static {
+		renamed[label] = value
+	}
+	out := make([]string, len(d.outputNames))
+	for i, label := range d.outputNames {
+		out[i] = renamed[label]
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAll(list []string, items []string) bool {
+	for _, item := range items {
+		if !contains(list, item) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestLabelConfigCompile(t *testing.T) {
+	tests := []struct {
+		name   string
+		config LabelConfig
+		err    string // substring of the error, empty if valid
+	}{
+		{"empty", LabelConfig{}, ""},
+		{"readme example", LabelConfig{
+			Static:  map[string]string{"cluster": "hpc"},
+			Rename:  map[string]string{"Hostname": "instance", "modelName": "model"},
+			Drop:    []string{"ppid"},
+			Relabel: []RelabelRule{{SourceLabels: []string{"procName"}, Regex: "python[0-9.]*", Replacement: "python"}},
+		}, ""},
+		{"drop gpu", LabelConfig{Drop: []string{"gpu"}}, "cannot drop label gpu"},
+		{"drop pid", LabelConfig{Drop: []string{"pid"}}, "cannot drop label pid"},
+		{"drop extra label", LabelConfig{Drop: []string{LabelFan}}, "cannot drop label fan"},
+		{"drop reason", LabelConfig{Drop: []string{LabelReason}}, "cannot drop label reason"},
+		{"rename to existing", LabelConfig{Rename: map[string]string{"Hostname": "gpu"}}, "the label exists"},
+		{"rename to renamed", LabelConfig{Rename: map[string]string{"Hostname": "gpu", "gpu": "index"}}, ""},
+		{"rename to dropped", LabelConfig{Rename: map[string]string{"Hostname": "ppid"}, Drop: []string{"ppid"}}, ""},
+		{"rename twice", LabelConfig{Rename: map[string]string{"Hostname": "node", "user": "node"}}, "cannot rename both"},
+		{"rename invalid", LabelConfig{Rename: map[string]string{"Hostname": "1node"}}, "invalid label name"},
+		{"static existing", LabelConfig{Static: map[string]string{"gpu": "0"}}, "overwrites an existing label"},
+		{"static renamed to", LabelConfig{Static: map[string]string{"instance": "x"}, Rename: map[string]string{"Hostname": "instance"}}, "overwrites an existing label"},
+		{"static invalid", LabelConfig{Static: map[string]string{"a-b": "x"}}, "invalid static label name"},
+		{"relabel series label", LabelConfig{Relabel: []RelabelRule{{SourceLabels: []string{"UUID"}, TargetLabel: "gpu"}}}, "cannot overwrite gpu"},
+		{"relabel source only", LabelConfig{Relabel: []RelabelRule{{SourceLabels: []string{"pid"}}}}, "cannot overwrite pid"},
+		{"relabel no source", LabelConfig{Relabel: []RelabelRule{{TargetLabel: "x"}}}, "sourceLabels is empty"},
+		{"relabel two sources", LabelConfig{Relabel: []RelabelRule{{SourceLabels: []string{"user", "procName"}}}}, "targetLabel is required"},
+		{"relabel bad regex", LabelConfig{Relabel: []RelabelRule{{SourceLabels: []string{"user"}, Regex: "("}}}, "invalid regex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Compile()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && err == nil:
+				t.Errorf("no error, want %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Errorf("error %q, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	lc := &LabelConfig{
+		Static: map[string]string{"cluster": "hpc"},
+		Rename: map[string]string{"Hostname": "instance"},
+		Drop:   []string{"modelName"},
+		Relabel: []RelabelRule{
+			{SourceLabels: []string{"modelName"}, Regex: "NVIDIA (.*)", TargetLabel: "model"},
+		},
+	}
+	if err := lc.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Labels: lc}
+	desc := newMetricDesc(config, "gpu_temperature", "help", []string{"gpu", "modelName"}, prometheus.Labels{LabelHostName: "node1"})
+	m := &dto.Metric{}
+	if err := desc.mustNewConstMetric(prometheus.GaugeValue, 40, "0", "NVIDIA A100").Write(m); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, lp := range m.Label {
+		got[lp.GetName()] = lp.GetValue()
+	}
+	want := map[string]string{"gpu": "0", "model": "A100", "instance": "node1", "cluster": "hpc"}
+	if len(got) != len(want) {
+		t.Errorf("labels %v, want %v", got, want)
+	}
+	for label, value := range want {
+		if got[label] != value {
+			t.Errorf("%v=%q, want %q", label, got[label], value)
+		}
+	}
+}
@@ -34,7 +34,7 @@ var (
 	getSlurmProcessStatLabelValues = func(ps ProcessStat) []string {
 		// todo: json unmarshall
 		return []string{
-			fmt.Sprintf("%d", ps.GPUIndex),
+			ps.GPULabel,
 			fmt.Sprintf("%d", ps.Pid),
 			ps.ProcName,
 			ps.User,
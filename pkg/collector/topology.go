@@ -0,0 +1,287 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// size of the cpu and numa masks passed to nvml
+	topologyMaxCPUs     = 4096
+	topologyMaxNUMANode = 64
+
+	sysfsPCIDevicesPath = "/sys/bus/pci/devices"
+)
+
+// Link types between two GPUs, named as in `nvidia-smi topo -m`
+const (
+	LinkSelf       = "X"
+	LinkNVLink     = "NV"   // followed by the number of links, e.g. NV4
+	LinkBoard      = "BRD"  // on the same board
+	LinkPCIeSwitch = "PIX"  // at most a single PCIe switch
+	LinkPCIeMulti  = "PXB"  // multiple PCIe switches, no host bridge
+	LinkHostBridge = "PHB"  // a PCIe host bridge
+	LinkNUMANode   = "NODE" // host bridges within a NUMA node
+	LinkSystem     = "SYS"  // the SMP interconnect between NUMA nodes
+	LinkUnknown    = "N/A"
+)
+
+// GPULink is how a GPU is connected to one peer GPU
+type GPULink struct {
+	GPUIndex    uint   `json:"gpu"`
+	UUID        string `json:"UUID"`
+	PCIBusID    string `json:"pciBusID"`
+	MinorNumber int    `json:"minorNumber"`
+	Link        string `json:"link"`
+	NVLinks     int    `json:"nvlinks"`
+}
+
+// Topology is the GPU matrix served on /debug/topology
+type Topology struct {
+	GPUs   []TopologyGPU `json:"gpus"`
+	Matrix [][]string    `json:"matrix"` // Matrix[i][j] is the link between GPUs[i] and GPUs[j]
+}
+
+type TopologyGPU struct {
+	GPUIndex    uint   `json:"gpu"`
+	UUID        string `json:"UUID"`
+	PCIBusID    string `json:"pciBusID"`
+	NUMANode    int    `json:"numaNode"`
+	CPUAffinity string `json:"cpuAffinity"`
+}
+
+// probeTopology fills NUMANode, CPUAffinity and Links of every device, it must
+// run once all devices are initialized.
+func probeTopology(devices []GPUDevice) {
+	nvlinks := make([]map[int]int, len(devices))
+	switchLinks := make([]int, len(devices))
+	for i := range devices {
+		g := &devices[i]
+		g.NUMANode = deviceNUMANode(g)
+		if mask, ret := g.GetCpuAffinity(topologyMaxCPUs); ret == nvml.SUCCESS {
+			g.CPUAffinity = FormatCPUList(maskToCPUs(mask))
+		}
+		nvlinks[i], switchLinks[i] = deviceNVLinks(g, devices)
+	}
+
+	for i := range devices {
+		links := make([]GPULink, 0, len(devices)-1)
+		for j := range devices {
+			if i == j {
+				continue
+			}
+			link := GPULink{
+				GPUIndex:    devices[j].GPUIndex,
+				UUID:        devices[j].UUID,
+				PCIBusID:    devices[j].PCIBusID,
+				MinorNumber: devices[j].MinorNumber,
+			}
+			link.NVLinks = nvlinks[i][j]
+			// gpus behind the same nvswitch talk over all their switch links
+			if link.NVLinks == 0 && switchLinks[i] > 0 && switchLinks[j] > 0 {
+				link.NVLinks = switchLinks[i]
+				if switchLinks[j] < link.NVLinks {
+					link.NVLinks = switchLinks[j]
+				}
+			}
+			if link.NVLinks > 0 {
+				link.Link = fmt.Sprintf("%s%d", LinkNVLink, link.NVLinks)
+			} else if level, ret := devices[i].GetTopologyCommonAncestor(devices[j].Device); ret == nvml.SUCCESS {
+				link.Link = topologyLevelName(level)
+			} else {
+				link.Link = LinkUnknown
+			}
+			links = append(links, link)
+		}
+		devices[i].Links = links
+		logrus.Debugf("gpu:%d, numa node:%d, cpu affinity:%v, links:%+v",
+			devices[i].GPUIndex, devices[i].NUMANode, devices[i].CPUAffinity, links)
+	}
+}
+
+// deviceNVLinks counts the active nvlinks to every peer GPU, and to nvswitches
+func deviceNVLinks(g *GPUDevice, devices []GPUDevice) (map[int]int, int) {
+	peers := make(map[int]int)
+	switchLinks := 0
+	for link := 0; link < nvml.NVLINK_MAX_LINKS; link++ {
+		state, ret := g.GetNvLinkState(link)
+		if ret != nvml.SUCCESS || state != nvml.FEATURE_ENABLED {
+			continue
+		}
+		if deviceType, ret := g.GetNvLinkRemoteDeviceType(link); ret == nvml.SUCCESS && deviceType == nvml.NVLINK_DEVICE_TYPE_SWITCH {
+			switchLinks++
+			continue
+		}
+		remote, ret := g.GetNvLinkRemotePciInfo(link)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		busID := pciBusID(remote)
+		for j := range devices {
+			if strings.EqualFold(devices[j].PCIBusID, busID) {
+				peers[j]++
+				break
+			}
+		}
+	}
+	return peers, switchLinks
+}
+
+// deviceNUMANode reads the node of the PCI device from sysfs, falls back to the
+// nvml memory affinity, -1 if unknown or the system has no NUMA.
+func deviceNUMANode(g *GPUDevice) int {
+	if g.PCIBusID != "" {
+		data, err := os.ReadFile(filepath.Join(sysfsPCIDevicesPath, sysfsPCIAddress(g.PCIBusID), "numa_node"))
+		if err == nil {
+			if node, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+				return node
+			}
+		}
+	}
+	mask, ret := g.GetMemoryAffinity(topologyMaxNUMANode, nvml.AFFINITY_SCOPE_NODE)
+	if ret != nvml.SUCCESS {
+		return -1
+	}
+	nodes := maskToCPUs(mask)
+	if len(nodes) != 1 {
+		return -1
+	}
+	return nodes[0]
+}
+
+// sysfsPCIAddress converts 00000000:3B:00.0 to 0000:3b:00.0
+func sysfsPCIAddress(busID string) string {
+	parts := strings.SplitN(busID, ":", 2)
+	if len(parts) != 2 {
+		return strings.ToLower(busID)
+	}
+	domain := parts[0]
+	if len(domain) > 4 {
+		domain = domain[len(domain)-4:]
+	}
+	return strings.ToLower(domain + ":" + parts[1])
+}
+
+func topologyLevelName(level nvml.GpuTopologyLevel) string {
+	switch level {
+	case nvml.TOPOLOGY_INTERNAL:
+		return LinkBoard
+	case nvml.TOPOLOGY_SINGLE:
+		return LinkPCIeSwitch
+	case nvml.TOPOLOGY_MULTIPLE:
+		return LinkPCIeMulti
+	case nvml.TOPOLOGY_HOSTBRIDGE:
+		return LinkHostBridge
+	case nvml.TOPOLOGY_NODE:
+		return LinkNUMANode
+	case nvml.TOPOLOGY_SYSTEM:
+		return LinkSystem
+	default:
+		return LinkUnknown
+	}
+}
+
+// maskToCPUs returns the set bits of a nvml cpu or node mask
+func maskToCPUs(mask []uint) []int {
+	cpus := make([]int, 0)
+	bits := strconv.IntSize
+	for i, word := range mask {
+		for b := 0; b < bits; b++ {
+			if word&(1<<uint(b)) != 0 {
+				cpus = append(cpus, i*bits+b)
+			}
+		}
+	}
+	return cpus
+}
+
+// FormatCPUList renders sorted cpus in the kernel list format, e.g. 0-15,32-47
+func FormatCPUList(cpus []int) string {
+	var b strings.Builder
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		if i == j {
+			fmt.Fprintf(&b, "%d", cpus[i])
+		} else {
+			fmt.Fprintf(&b, "%d-%d", cpus[i], cpus[j])
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+// ParseCPUList parses the kernel list format, e.g. 0-15,32-47
+func ParseCPUList(list string) ([]int, error) {
+	cpus := make([]int, 0)
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return cpus, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu list %q, err: %v", list, err)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid cpu list %q, err: %v", list, err)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// GetTopology returns the GPU matrix probed at startup, or when the GPUs changed
+func (c *NVMLCache) GetTopology() Topology {
+	c.RLock()
+	defer c.RUnlock()
+	topology := Topology{
+		GPUs:   make([]TopologyGPU, 0, len(c.DeviceInfos)),
+		Matrix: make([][]string, 0, len(c.DeviceInfos)),
+	}
+	for i, d := range c.DeviceInfos {
+		topology.GPUs = append(topology.GPUs, TopologyGPU{
+			GPUIndex:    d.GPUIndex,
+			UUID:        d.UUID,
+			PCIBusID:    d.PCIBusID,
+			NUMANode:    d.NUMANode,
+			CPUAffinity: d.CPUAffinity,
+		})
+		row := make([]string, 0, len(c.DeviceInfos))
+		links := make(map[string]string, len(d.Links))
+		for _, link := range d.Links {
+			links[link.UUID] = link.Link
+		}
+		for j, peer := range c.DeviceInfos {
+			link, ok := links[peer.UUID]
+			switch {
+			case i == j:
+				row = append(row, LinkSelf)
+			// down gpus were not probed, their links are stale
+			case !ok || d.handleError != "" || peer.handleError != "":
+				row = append(row, LinkUnknown)
+			default:
+				row = append(row, link)
+			}
+		}
+		topology.Matrix = append(topology.Matrix, row)
+	}
+	return topology
+}
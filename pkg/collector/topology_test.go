@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list string
+		cpus []int
+	}{
+		{"", []int{}},
+		{"3", []int{3}},
+		{"0-3", []int{0, 1, 2, 3}},
+		{"0-1,4,6-7\n", []int{0, 1, 4, 6, 7}},
+	}
+	for _, tt := range tests {
+		cpus, err := ParseCPUList(tt.list)
+		if err != nil {
+			t.Errorf("ParseCPUList(%q): %v", tt.list, err)
+			continue
+		}
+		if !reflect.DeepEqual(cpus, tt.cpus) {
+			t.Errorf("ParseCPUList(%q) = %v, want %v", tt.list, cpus, tt.cpus)
+		}
+	}
+	for _, list := range []string{"a", "0-b", "0,,1", "-1"} {
+		if _, err := ParseCPUList(list); err == nil {
+			t.Errorf("ParseCPUList(%q) did not fail", list)
+		}
+	}
+}
+
+func TestFormatCPUList(t *testing.T) {
+	tests := []struct {
+		cpus []int
+		list string
+	}{
+		{nil, ""},
+		{[]int{3}, "3"},
+		{[]int{0, 1, 2, 3}, "0-3"},
+		{[]int{0, 1, 4, 6, 7}, "0-1,4,6-7"},
+	}
+	for _, tt := range tests {
+		if list := FormatCPUList(tt.cpus); list != tt.list {
+			t.Errorf("FormatCPUList(%v) = %q, want %q", tt.cpus, list, tt.list)
+		}
+		// the kernel format round trips
+		cpus, err := ParseCPUList(tt.list)
+		if err != nil || FormatCPUList(cpus) != tt.list {
+			t.Errorf("ParseCPUList(%q) = %v, %v", tt.list, cpus, err)
+		}
+	}
+}
+
+func TestMaskToCPUs(t *testing.T) {
+	mask := []uint{0x5, 0x1}
+	want := []int{0, 2, strconv.IntSize}
+	if cpus := maskToCPUs(mask); !reflect.DeepEqual(cpus, want) {
+		t.Errorf("maskToCPUs(%#x) = %v, want %v", mask, cpus, want)
+	}
+}
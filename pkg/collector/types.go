@@ -6,7 +6,9 @@
 package collector
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
@@ -24,21 +26,212 @@ type Config struct {
 	UseSlurm         bool
 	SupportedMetrics []string
 	HostName         string
+	// NamingLegacy, NamingV2, NamingBoth or NamingDCGM, empty is legacy
+	Naming string
+	// fields exported with NamingDCGM, DefaultDCGMCounters if empty
+	DCGMCounters []DCGMCounter
+	// relabeling of the collector metrics, nil if none
+	Labels *LabelConfig
+	// limits of the process series
+	Cardinality CardinalityConfig
+	// redaction of process command lines, nil if none
+	Redaction *RedactionConfig
+	// GPUs to monitor, nil for all
+	GPUFilter *GPUFilter
+	// seconds between rescans of the devices, 0 disables them
+	RescanInterval int
+	// GPULabelIndex, GPULabelMinor, GPULabelPCIBusID or GPULabelUUID, empty is index
+	GPULabel string
+}
+
+// legacyNames reports whether metrics are exported under their legacy names,
+// NamingDCGM keeps them for process metrics
+func (config *Config) legacyNames() bool {
+	return config.Naming != NamingV2
+}
+
+// v2Names reports whether metrics are exported under METRIC_V2_META_MAP names
+func (config *Config) v2Names() bool {
+	return config.Naming == NamingV2 || config.Naming == NamingBoth
 }
 
 type GPUDevice struct {
 	nvml.Device
 
 	GPUInfo
+
+	// reason the handle could not be acquired, the device is down until a
+	// rescan gets it
+	handleError string
 }
 
-// todo: add GPUInfo
 type GPUInfo struct {
 	UUID             string                `json:"UUID"`
 	GPUModelName     string                `json:"modelName"`
 	GPUIndex         uint                  `json:"gpuIndex"`
 	Attributes       nvml.DeviceAttributes `json:"attributes"`
 	PcieLinkMaxSpeed uint32                `json:"pcieLinkMaxSpeed"`
+
+	DriverVersion     string `json:"driverVersion"`
+	CudaDriverVersion string `json:"cudaDriverVersion"`
+	NVMLVersion       string `json:"nvmlVersion"`
+	VBIOSVersion      string `json:"vbiosVersion"`
+	Serial            string `json:"serial"`
+	BoardPartNumber   string `json:"boardPartNumber"`
+	PCIBusID          string `json:"pciBusID"`
+	Architecture      string `json:"architecture"`
+	ComputeCapability string `json:"computeCapability"`
+	MemoryTotalBytes  uint64 `json:"memoryTotalBytes"`
+	PersistenceMode   string `json:"persistenceMode"`
+	MinorNumber       int    `json:"minorNumber"` // of /dev/nvidia<minor>, -1 if unknown
+	ComputeMode       string `json:"computeMode"`
+
+	// topology, probed once all devices are known
+	NUMANode    int       `json:"numaNode"` // -1 if unknown
+	CPUAffinity string    `json:"cpuAffinity"`
+	Links       []GPULink `json:"links"`
+}
+
+// GPULabel is the value of the gpu label of the device, see Config.GPULabel
+func (info *GPUInfo) GPULabel(source string) string {
+	return gpuLabelValue(source, info.GPUIndex, info.UUID, info.PCIBusID, info.MinorNumber)
+}
+
+// gpuLabelValue falls back to the nvml index when the identifier is unknown
+func gpuLabelValue(source string, index uint, uuid string, pciBusID string, minor int) string {
+	switch {
+	case source == GPULabelMinor && minor >= 0:
+		return fmt.Sprintf("%d", minor)
+	case source == GPULabelPCIBusID && pciBusID != "":
+		return pciBusID
+	case source == GPULabelUUID && uuid != "":
+		return uuid
+	default:
+		return fmt.Sprintf("%d", index)
+	}
+}
+
+// GetInfoLabelValues returns the values of GPUInfoLabels after GPULabels
+func (info *GPUInfo) GetInfoLabelValues() []string {
+	return []string{
+		info.DriverVersion,
+		info.CudaDriverVersion,
+		info.NVMLVersion,
+		info.VBIOSVersion,
+		info.Serial,
+		info.BoardPartNumber,
+		info.Architecture,
+		info.ComputeCapability,
+		fmt.Sprintf("%d", info.MemoryTotalBytes),
+		info.PersistenceMode,
+		info.ComputeMode,
+	}
+}
+
+// GetInfoSeries returns the label values after GPULabels of every series of an
+// info metric, see IsGPUInfoMetric. Peer GPUs are labeled by gpuLabel.
+func (info *GPUInfo) GetInfoSeries(metricName string, gpuLabel string) [][]string {
+	switch metricName {
+	case GPU_INFO:
+		return [][]string{info.GetInfoLabelValues()}
+	case GPU_NUMA_INFO:
+		return [][]string{{fmt.Sprintf("%d", info.NUMANode), info.CPUAffinity}}
+	case GPU_TOPOLOGY_INFO:
+		series := make([][]string, 0, len(info.Links))
+		for _, link := range info.Links {
+			peer := gpuLabelValue(gpuLabel, link.GPUIndex, link.UUID, link.PCIBusID, link.MinorNumber)
+			series = append(series, []string{peer, link.UUID, link.Link})
+		}
+		return series
+	default:
+		return nil
+	}
+}
+
+// DeviceGetGPUInfo fills the static device information, fields the device does
+// not support are left empty.
+func (g *GPUDevice) DeviceGetGPUInfo() {
+	g.VBIOSVersion, _ = g.GetVbiosVersion()
+	g.Serial, _ = g.GetSerial()
+	g.BoardPartNumber, _ = g.GetBoardPartNumber()
+	if pciInfo, ret := g.GetPciInfo(); ret == nvml.SUCCESS {
+		g.PCIBusID = pciBusID(pciInfo)
+	}
+	if arch, ret := g.GetArchitecture(); ret == nvml.SUCCESS {
+		g.Architecture = architectureName(arch)
+	}
+	if major, minor, ret := g.GetCudaComputeCapability(); ret == nvml.SUCCESS {
+		g.ComputeCapability = fmt.Sprintf("%d.%d", major, minor)
+	}
+	if memoryInfo, ret := g.GetMemoryInfo(); ret == nvml.SUCCESS {
+		g.MemoryTotalBytes = memoryInfo.Total
+	}
+	if mode, ret := g.GetPersistenceMode(); ret == nvml.SUCCESS {
+		g.PersistenceMode = enableStateName(mode)
+	}
+	if mode, ret := g.GetComputeMode(); ret == nvml.SUCCESS {
+		g.ComputeMode = computeModeName(mode)
+	}
+	g.MinorNumber = -1
+	if minor, ret := g.GetMinorNumber(); ret == nvml.SUCCESS {
+		g.MinorNumber = minor
+	}
+}
+
+func pciBusID(pciInfo nvml.PciInfo) string {
+	var b strings.Builder
+	for _, c := range pciInfo.BusId {
+		if c == 0 {
+			break
+		}
+		b.WriteByte(byte(c))
+	}
+	return b.String()
+}
+
+func architectureName(arch nvml.DeviceArchitecture) string {
+	switch arch {
+	case nvml.DEVICE_ARCH_KEPLER:
+		return "Kepler"
+	case nvml.DEVICE_ARCH_MAXWELL:
+		return "Maxwell"
+	case nvml.DEVICE_ARCH_PASCAL:
+		return "Pascal"
+	case nvml.DEVICE_ARCH_VOLTA:
+		return "Volta"
+	case nvml.DEVICE_ARCH_TURING:
+		return "Turing"
+	case nvml.DEVICE_ARCH_AMPERE:
+		return "Ampere"
+	case nvml.DEVICE_ARCH_ADA:
+		return "Ada"
+	case nvml.DEVICE_ARCH_HOPPER:
+		return "Hopper"
+	default:
+		return "Unknown"
+	}
+}
+
+func enableStateName(state nvml.EnableState) string {
+	if state == nvml.FEATURE_ENABLED {
+		return "Enabled"
+	}
+	return "Disabled"
+}
+
+func computeModeName(mode nvml.ComputeMode) string {
+	switch mode {
+	case nvml.COMPUTEMODE_DEFAULT:
+		return "Default"
+	case nvml.COMPUTEMODE_EXCLUSIVE_THREAD:
+		return "ExclusiveThread"
+	case nvml.COMPUTEMODE_PROHIBITED:
+		return "Prohibited"
+	case nvml.COMPUTEMODE_EXCLUSIVE_PROCESS:
+		return "ExclusiveProcess"
+	default:
+		return "Unknown"
+	}
 }
 
 // type DeviceAttributes struct {
@@ -56,6 +249,7 @@ type GPUInfo struct {
 type ProcessStat struct {
 	Pid         uint32 `json:"pid"`
 	GPUIndex    int    `json:"gpu"`
+	GPULabel    string `json:"gpuLabel"` // value of the gpu label, see Config.GPULabel
 	ProcName    string `json:"procName"`
 	User        string `json:"user"`
 	Status      string `json:"status"`
@@ -67,6 +261,8 @@ type ProcessStat struct {
 	CPUPercent         float64 `json:"cpu_percent"`
 	CPUMemoryUsedBytes uint64  `json:"cpu_mem_used_bytes"`
 	NumThreads         int32   `json:"num_threads"`
+	AllowedCPUs        string  `json:"allowedCPUs"`      // Cpus_allowed_list, e.g. 0-15
+	AllowedNUMANodes   string  `json:"allowedNUMANodes"` // Mems_allowed_list
 
 	// TODO:
 	// IOCounters
@@ -79,6 +275,8 @@ type ProcessStat struct {
 	Decutil            uint32 `json:"decutil"`
 	Encutil            uint32 `json:"encutil"`
 	GPUUsedMemoryBytes uint64 `json:"gpu_used_memory_bytes"`
+	EncoderSessions    uint32 `json:"encoder_sessions"`
+	NUMAMismatch       bool   `json:"numa_mismatch"` // bound away from the GPU's cpus or numa node
 
 	// Slurm Lables
 	SlurmProcInfo
@@ -88,31 +286,215 @@ type GPUStat struct {
 	GPUIndex     uint
 	UUID         string
 	GPUModelName string
+	PCIBusID     string
+	MinorNumber  int    // -1 if unknown
+	GPULabel     string // value of the gpu label, see Config.GPULabel
+
+	Up    bool   `json:"up"`    // false if the device cannot be queried, e.g. fell off the bus
+	Error string `json:"error"` // why the device is down, e.g. GPU_IS_LOST
 
 	SMClock  uint32 `json:"sm_clock"`  //gauge, SM clock frequency (in MHz).
 	MemClock uint32 `json:"mem_clock"` //gauge, Memory clock frequency (in MHz).
 
-	PowerUsage             uint32 `json:"power_usage"`        // gauge, Power draw (in W).
-	TotalEnergyConsumption uint64 `json:"energy_consumption"` //  counter, Total energy consumption since boot (in mJ).
+	PowerUsage             float64 `json:"power_usage"`         // gauge, Power draw (in W), milliwatt precision.
+	TotalEnergyConsumption uint64  `json:"energy_consumption"`  //  counter, Total energy consumption since boot (in mJ).
+	PowerLimit             float64 `json:"power_limit"`         // gauge, Enforced power limit (in W).
+	PowerDefaultLimit      float64 `json:"power_default_limit"` // gauge, Default power limit (in W).
+	PowerMinLimit          float64 `json:"power_min_limit"`     // gauge, Min power limit constraint (in W), -1 if not supported.
+	PowerMaxLimit          float64 `json:"power_max_limit"`     // gauge, Max power limit constraint (in W), -1 if not supported.
+	PowerManagementMode    uint32  `json:"power_management_mode"`
+	PowerState             int32   `json:"power_state"` // P-state, -1 if unknown
 
-	FanSpeed    uint32 `json:"fan_speed"`
 	Temperature uint32 `json:"temperature"`
+	// -1 if not supported, memory temperature is only reported by HBM boards
+	MemoryTemperature            int32  `json:"memory_temperature"`
+	TemperatureSlowdownThreshold uint32 `json:"temperature_slowdown_threshold"`
+	TemperatureShutdownThreshold uint32 `json:"temperature_shutdown_threshold"`
 
 	GPUUtil     uint32 `json:"gpu_util"`
 	EncoderUtil uint32 `json:"encoder_util"`
 	DecoderUtil uint32 `json:"dncoder_util"`
 	MemCopyUtil uint32 `json:"memcpy_util"`
 
-	PCIETXBytes uint32 `json:"pcie_tx_bytes"` // gauge, The rate of data transmitted over the PCIe bus - including both protocol headers and data payloads - in bytes per second.
-	PCIERXBytes uint32 `json:"pcie_rx_bytes"` // gauge, The rate of data received over the PCIe bus - including both protocol headers and data payloads - in bytes per second.
+	EncoderSessionCount   uint32 `json:"encoder_session_count"`
+	EncoderAverageFPS     uint32 `json:"encoder_average_fps"`
+	EncoderAverageLatency uint32 `json:"encoder_average_latency"` // in us
+	FBCSessionCount       uint32 `json:"fbc_session_count"`
+	FBCAverageFPS         uint32 `json:"fbc_average_fps"`
+	FBCAverageLatency     uint32 `json:"fbc_average_latency"` // in us
+
+	PCIETXBytes uint64 `json:"pcie_tx_bytes"` // gauge, The rate of data transmitted over the PCIe bus - including both protocol headers and data payloads - in bytes per second.
+	PCIERXBytes uint64 `json:"pcie_rx_bytes"` // gauge, The rate of data received over the PCIe bus - including both protocol headers and data payloads - in bytes per second.
+	// counters integrated by NVMLCache from successive throughput samples
+	PCIETXBytesTotal float64 `json:"pcie_tx_bytes_total"`
+	PCIERXBytesTotal float64 `json:"pcie_rx_bytes_total"`
+
+	PCIELinkGenCurrent   uint32 `json:"pcie_link_gen_current"`
+	PCIELinkGenMax       uint32 `json:"pcie_link_gen_max"`
+	PCIELinkWidthCurrent uint32 `json:"pcie_link_width_current"`
+	PCIELinkWidthMax     uint32 `json:"pcie_link_width_max"`
+	PCIEReplayCounter    uint64 `json:"pcie_replay_counter"` // counter
+	PCIELinkDegraded     uint32 `json:"pcie_link_degraded"`  // 1 if width < max width while busy
+
+	// profiling metrics by name, from the ProfilingBackend or estimated from NVML
+	Profiling map[string]ProfilingValue `json:"profiling,omitempty"`
 
-	// DCGM_FI_PROF_DRAM_ACTIVE,        gauge, Ratio of cycles the device memory interface is active sending or receiving data (in %).
-	// DCGM_FI_PROF_GR_ENGINE_ACTIVE,   gauge, Ratio of time the graphics engine is active (in %).
 	// DCGM_FI_DEV_NVLINK_BANDWIDTH_TOTAL,            counter, Total number of NVLink bandwidth counters for all lanes.
 
 	// MemoryUtil uint32 `json:"mem_util"`
-	MemoryFreeBytes uint64 `json:"mem_free_bytes"`
-	MemoryUsedBytes uint64 `json:"mem_used_bytes"`
+	MemoryFreeBytes     uint64 `json:"mem_free_bytes"`
+	MemoryUsedBytes     uint64 `json:"mem_used_bytes"`
+	MemoryTotalBytes    uint64 `json:"mem_total_bytes"`
+	MemoryReservedBytes uint64 `json:"mem_reserved_bytes"` // from the v2 memory info, 0 on older drivers
+	BAR1TotalBytes      uint64 `json:"bar1_total_bytes"`
+	BAR1UsedBytes       uint64 `json:"bar1_used_bytes"`
+	BAR1FreeBytes       uint64 `json:"bar1_free_bytes"`
+
+	Clocks []ClockStat `json:"clocks,omitempty"`
+	Fans   []FanStat   `json:"fans,omitempty"` // empty for fanless boards
+}
+
+// DeviceGetMemoryTemperature reads the memory temperature field in C, -1 if the
+// board has no memory sensor
+func (g *GPUDevice) DeviceGetMemoryTemperature() int32 {
+	values := []nvml.FieldValue{{FieldId: nvml.FI_DEV_MEMORY_TEMP}}
+	if ret := g.GetFieldValues(values); ret != nvml.SUCCESS {
+		return -1
+	}
+	if nvml.Return(values[0].NvmlReturn) != nvml.SUCCESS {
+		return -1
+	}
+	return int32(fieldValueToFloat(values[0]))
+}
+
+// fieldValueToFloat decodes the union value of a field, nvml fills it in host byte order
+func fieldValueToFloat(value nvml.FieldValue) float64 {
+	switch nvml.ValueType(value.ValueType) {
+	case nvml.VALUE_TYPE_DOUBLE:
+		return math.Float64frombits(binary.LittleEndian.Uint64(value.Value[:]))
+	case nvml.VALUE_TYPE_UNSIGNED_INT:
+		return float64(binary.LittleEndian.Uint32(value.Value[:4]))
+	case nvml.VALUE_TYPE_UNSIGNED_LONG, nvml.VALUE_TYPE_UNSIGNED_LONG_LONG:
+		return float64(binary.LittleEndian.Uint64(value.Value[:]))
+	case nvml.VALUE_TYPE_SIGNED_LONG_LONG:
+		return float64(int64(binary.LittleEndian.Uint64(value.Value[:])))
+	default:
+		return 0
+	}
+}
+
+// LabeledValue is one series of a metric in METRIC_EXTRA_LABELS
+type LabeledValue struct {
+	LabelValues []string
+	Value       float64
+}
+
+// ClockStat holds the clocks of one domain in MHz, 0 if not supported
+type ClockStat struct {
+	Domain             string `json:"domain"`
+	Current            uint32 `json:"current"`
+	Max                uint32 `json:"max"`
+	Application        uint32 `json:"application"`
+	DefaultApplication uint32 `json:"default_application"`
+	BoostMax           uint32 `json:"boost_max"`
+	PStateMin          uint32 `json:"pstate_min"`
+	PStateMax          uint32 `json:"pstate_max"`
+	// clock offset of the V/F curve and its settable range, graphics and
+	// memory only, valid if HasVfOffset since an offset can be 0 or negative
+	VfOffset    int  `json:"vf_offset"`
+	VfOffsetMin int  `json:"vf_offset_min"`
+	VfOffsetMax int  `json:"vf_offset_max"`
+	HasVfOffset bool `json:"has_vf_offset"`
+}
+
+// FanStat holds one fan of the board, -1 if a value is not supported
+type FanStat struct {
+	Fan           int `json:"fan"`
+	Speed         int `json:"speed"`        // in %
+	TargetSpeed   int `json:"target_speed"` // in %
+	ControlPolicy int `json:"control_policy"`
+}
+
+var clockDomains = []struct {
+	name      string
+	clockType nvml.ClockType
+}{
+	{"graphics", nvml.CLOCK_GRAPHICS},
+	{"sm", nvml.CLOCK_SM},
+	{"memory", nvml.CLOCK_MEM},
+	{"video", nvml.CLOCK_VIDEO},
+}
+
+// DeviceGetClockStats queries every clock domain.
+// NVML has no query for the clocks locked with nvidia-smi -lgc/-lmc, so they
+// are not reported. The P-state range and the V/F curve offsets are.
+func (g *GPUDevice) DeviceGetClockStats() []ClockStat {
+	pstate, pstateRet := g.GetPerformanceState()
+	clocks := make([]ClockStat, 0, len(clockDomains))
+	for _, d := range clockDomains {
+		clock := ClockStat{Domain: d.name}
+		clock.Current, _ = g.GetClockInfo(d.clockType)
+		clock.Max, _ = g.GetMaxClockInfo(d.clockType)
+		clock.Application, _ = g.GetApplicationsClock(d.clockType)
+		clock.DefaultApplication, _ = g.GetDefaultApplicationsClock(d.clockType)
+		clock.BoostMax, _ = g.GetMaxCustomerBoostClock(d.clockType)
+		if pstateRet == nvml.SUCCESS && pstate != nvml.PSTATE_UNKNOWN {
+			clock.PStateMin, clock.PStateMax, _ = g.GetMinMaxClockOfPState(d.clockType, pstate)
+		}
+		g.getVfOffset(&clock, d.clockType)
+		clocks = append(clocks, clock)
+	}
+	return clocks
+}
+
+// getVfOffset reads the clock offset of the graphics (GPC) or memory V/F curve
+func (g *GPUDevice) getVfOffset(clock *ClockStat, clockType nvml.ClockType) {
+	var ret, rangeRet nvml.Return
+	switch clockType {
+	case nvml.CLOCK_GRAPHICS:
+		clock.VfOffset, ret = g.GetGpcClkVfOffset()
+		clock.VfOffsetMin, clock.VfOffsetMax, rangeRet = g.GetGpcClkMinMaxVfOffset()
+	case nvml.CLOCK_MEM:
+		clock.VfOffset, ret = g.GetMemClkVfOffset()
+		clock.VfOffsetMin, clock.VfOffsetMax, rangeRet = g.GetMemClkMinMaxVfOffset()
+	default:
+		return
+	}
+	clock.HasVfOffset = ret == nvml.SUCCESS && rangeRet == nvml.SUCCESS
+}
+
+// DeviceGetFanStats returns every fan of the board, nil for fanless boards
+func (g *GPUDevice) DeviceGetFanStats() []FanStat {
+	numFans, ret := g.GetNumFans()
+	if ret != nvml.SUCCESS {
+		// drivers without nvmlDeviceGetNumFans only report the first fan
+		speed, ret := g.GetFanSpeed()
+		if ret != nvml.SUCCESS {
+			return nil
+		}
+		return []FanStat{{Fan: 0, Speed: int(speed), TargetSpeed: -1, ControlPolicy: -1}}
+	}
+	fans := make([]FanStat, 0, numFans)
+	for i := 0; i < numFans; i++ {
+		fan := FanStat{Fan: i, Speed: -1, TargetSpeed: -1, ControlPolicy: -1}
+		if speed, ret := g.GetFanSpeed_v2(i); ret == nvml.SUCCESS {
+			fan.Speed = int(speed)
+		}
+		if target, ret := g.GetTargetFanSpeed(i); ret == nvml.SUCCESS {
+			fan.TargetSpeed = target
+		}
+		if policy, ret := g.GetFanControlPolicy_v2(i); ret == nvml.SUCCESS {
+			fan.ControlPolicy = int(policy)
+		}
+		fans = append(fans, fan)
+	}
+	return fans
+}
+
+// pcieThroughputBytes samples the PCIe throughput for 20ms
+func (g *GPUDevice) pcieThroughputBytes(counter nvml.PcieUtilCounter) (uint64, nvml.Return) {
+	kb, ret := g.GetPcieThroughput(counter)
+	return uint64(kb) * 1024, ret // KB/s 转换为bytes per second
 }
 
 // [x]: configuration
@@ -122,12 +504,19 @@ func (g *GPUDevice) DeviceGetGPUStat(metrics []string) GPUStat {
 		GPUIndex:     g.GPUIndex,
 		UUID:         g.UUID,
 		GPUModelName: g.GPUModelName,
+		PCIBusID:     g.PCIBusID,
+		MinorNumber:  g.MinorNumber,
+		Up:           true,
 	}
 	utilizationRates, ret := g.GetUtilizationRates()
 	if ret != nvml.SUCCESS {
 		logrus.Errorf("cannot get utilizationRates of gpu:%v", g.GPUIndex)
 	}
 	memoryInfo, _ := g.GetMemoryInfo()
+	pcieTXQueried, pcieRXQueried := false, false
+	var pcieTXRet, pcieRXRet nvml.Return
+	bar1Queried, encoderQueried, fbcQueried := false, false, false
+	powerLimitsQueried := false
 	for _, metric := range metrics {
 		if !ISGPUMetricName(metric) {
 			continue
@@ -137,20 +526,90 @@ func (g *GPUDevice) DeviceGetGPUStat(metrics []string) GPUStat {
 			gpuStat.SMClock, _ = g.GetClockInfo(nvml.CLOCK_SM)
 		case GPU_MEMORY_CLOCK:
 			gpuStat.MemClock, _ = g.GetClockInfo(nvml.CLOCK_MEM)
+		case GPU_CLOCK_CURRENT, GPU_CLOCK_MAX, GPU_CLOCK_APPLICATION, GPU_CLOCK_DEFAULT_APPLICATION,
+			GPU_CLOCK_BOOST_MAX, GPU_CLOCK_PSTATE_MIN, GPU_CLOCK_PSTATE_MAX,
+			GPU_CLOCK_VF_OFFSET, GPU_CLOCK_VF_OFFSET_MIN, GPU_CLOCK_VF_OFFSET_MAX:
+			if gpuStat.Clocks == nil {
+				gpuStat.Clocks = g.DeviceGetClockStats()
+			}
+		case GPU_FAN_SPEED, GPU_FAN_TARGET_SPEED, GPU_FAN_CONTROL_POLICY:
+			if gpuStat.Fans == nil {
+				gpuStat.Fans = g.DeviceGetFanStats()
+			}
 		case GPU_TEMPERATURE:
 			gpuStat.Temperature, _ = g.GetTemperature(nvml.TEMPERATURE_GPU)
+		case GPU_MEMORY_TEMPERATURE:
+			gpuStat.MemoryTemperature = g.DeviceGetMemoryTemperature()
+		case GPU_TEMPERATURE_SLOWDOWN_THRESHOLD:
+			gpuStat.TemperatureSlowdownThreshold, _ = g.GetTemperatureThreshold(nvml.TEMPERATURE_THRESHOLD_SLOWDOWN)
+		case GPU_TEMPERATURE_SHUTDOWN_THRESHOLD:
+			gpuStat.TemperatureShutdownThreshold, _ = g.GetTemperatureThreshold(nvml.TEMPERATURE_THRESHOLD_SHUTDOWN)
 		case GPU_POWER_USAGE:
 			power, _ := g.GetPowerUsage()
-			gpuStat.PowerUsage = power / 1000 // 转换为W
+			gpuStat.PowerUsage = float64(power) / 1000 // mW 转换为W
+		case GPU_POWER_LIMIT:
+			limit, _ := g.GetEnforcedPowerLimit()
+			gpuStat.PowerLimit = float64(limit) / 1000
+		case GPU_POWER_DEFAULT_LIMIT:
+			limit, _ := g.GetPowerManagementDefaultLimit()
+			gpuStat.PowerDefaultLimit = float64(limit) / 1000
+		case GPU_POWER_MIN_LIMIT, GPU_POWER_MAX_LIMIT:
+			if !powerLimitsQueried {
+				powerLimitsQueried = true
+				gpuStat.PowerMinLimit, gpuStat.PowerMaxLimit = -1, -1
+				if minLimit, maxLimit, ret := g.GetPowerManagementLimitConstraints(); ret == nvml.SUCCESS {
+					gpuStat.PowerMinLimit = float64(minLimit) / 1000
+					gpuStat.PowerMaxLimit = float64(maxLimit) / 1000
+				}
+			}
+		case GPU_POWER_MANAGEMENT_MODE:
+			mode, _ := g.GetPowerManagementMode()
+			if mode == nvml.FEATURE_ENABLED {
+				gpuStat.PowerManagementMode = 1
+			}
+		case GPU_POWER_STATE:
+			gpuStat.PowerState = -1
+			pstate, ret := g.GetPerformanceState()
+			if ret == nvml.SUCCESS && pstate != nvml.PSTATE_UNKNOWN {
+				gpuStat.PowerState = int32(pstate)
+			}
 		case GPU_TOTAL_ENERGY_CONSUMPTION:
 			energy, _ := g.GetTotalEnergyConsumption()
-			gpuStat.TotalEnergyConsumption = energy * 1000 // 转换为mJ
-		case GPU_PCIE_TX_BYTES:
-			kb, _ := g.GetPcieThroughput(nvml.PCIE_UTIL_TX_BYTES)
-			gpuStat.PCIETXBytes = kb * 1024 // KB/s 转换为bytes per second
-		case GPU_PCIE_RX_BYTES:
-			kb, _ := g.GetPcieThroughput(nvml.PCIE_UTIL_RX_BYTES)
-			gpuStat.PCIERXBytes = kb * 1024 // KB/s 转换为bytes per second
+			gpuStat.TotalEnergyConsumption = energy // mJ
+		case GPU_PCIE_TX_BYTES, GPU_PCIE_TX_BYTES_PER_SECOND, GPU_PCIE_TX_BYTES_TOTAL:
+			// each query samples for 20ms, only query once
+			if !pcieTXQueried {
+				gpuStat.PCIETXBytes, pcieTXRet = g.pcieThroughputBytes(nvml.PCIE_UTIL_TX_BYTES)
+				pcieTXQueried = true
+			}
+		case GPU_PCIE_RX_BYTES, GPU_PCIE_RX_BYTES_PER_SECOND, GPU_PCIE_RX_BYTES_TOTAL:
+			if !pcieRXQueried {
+				gpuStat.PCIERXBytes, pcieRXRet = g.pcieThroughputBytes(nvml.PCIE_UTIL_RX_BYTES)
+				pcieRXQueried = true
+			}
+		case GPU_PCIE_LINK_GEN_CURRENT:
+			gen, _ := g.GetCurrPcieLinkGeneration()
+			gpuStat.PCIELinkGenCurrent = uint32(gen)
+		case GPU_PCIE_LINK_GEN_MAX:
+			gen, _ := g.GetMaxPcieLinkGeneration()
+			gpuStat.PCIELinkGenMax = uint32(gen)
+		case GPU_PCIE_LINK_WIDTH_CURRENT:
+			width, _ := g.GetCurrPcieLinkWidth()
+			gpuStat.PCIELinkWidthCurrent = uint32(width)
+		case GPU_PCIE_LINK_WIDTH_MAX:
+			width, _ := g.GetMaxPcieLinkWidth()
+			gpuStat.PCIELinkWidthMax = uint32(width)
+		case GPU_PCIE_REPLAY_COUNTER:
+			replay, _ := g.GetPcieReplayCounter()
+			gpuStat.PCIEReplayCounter = uint64(replay)
+		case GPU_PCIE_LINK_DEGRADED:
+			// links may train down when idle to save power, only busy GPUs count
+			curWidth, curRet := g.GetCurrPcieLinkWidth()
+			maxWidth, maxRet := g.GetMaxPcieLinkWidth()
+			if curRet == nvml.SUCCESS && maxRet == nvml.SUCCESS &&
+				curWidth < maxWidth && utilizationRates.Gpu > 0 {
+				gpuStat.PCIELinkDegraded = 1
+			}
 		case GPU_UTILIZATION:
 			gpuStat.GPUUtil = utilizationRates.Gpu
 		case GPU_MEM_COPY_UTILIZATION:
@@ -158,11 +617,71 @@ func (g *GPUDevice) DeviceGetGPUStat(metrics []string) GPUStat {
 		case GPU_ENC_UTILIZATION:
 			gpuStat.EncoderUtil, _, _ = g.GetEncoderUtilization()
 		case GPU_DEC_UTILIZATION:
-			gpuStat.DecoderUtil, _, _ = g.GetEncoderUtilization()
+			gpuStat.DecoderUtil, _, _ = g.GetDecoderUtilization()
+		case GPU_ENCODER_SESSION_COUNT, GPU_ENCODER_AVERAGE_FPS, GPU_ENCODER_AVERAGE_LATENCY:
+			if !encoderQueried {
+				count, fps, latency, ret := g.GetEncoderStats()
+				if ret == nvml.SUCCESS {
+					gpuStat.EncoderSessionCount = uint32(count)
+					gpuStat.EncoderAverageFPS = fps
+					gpuStat.EncoderAverageLatency = latency
+				}
+				encoderQueried = true
+			}
+		case GPU_FBC_SESSION_COUNT, GPU_FBC_AVERAGE_FPS, GPU_FBC_AVERAGE_LATENCY:
+			if !fbcQueried {
+				if fbcStats, ret := g.GetFBCStats(); ret == nvml.SUCCESS {
+					gpuStat.FBCSessionCount = fbcStats.SessionsCount
+					gpuStat.FBCAverageFPS = fbcStats.AverageFPS
+					gpuStat.FBCAverageLatency = fbcStats.AverageLatency
+				}
+				fbcQueried = true
+			}
+		case GPU_PROF_GR_ENGINE_ACTIVE:
+			// NVML only samples whether a kernel was running, close to the engine activity
+			if ret == nvml.SUCCESS {
+				gpuStat.setProfiling(metric, float64(utilizationRates.Gpu)/100, ProfilingSourceNVML)
+			}
+		case GPU_PROF_DRAM_ACTIVE:
+			if ret == nvml.SUCCESS {
+				gpuStat.setProfiling(metric, float64(utilizationRates.Memory)/100, ProfilingSourceNVML)
+			}
+		case GPU_PROF_PCIE_TX_BYTES:
+			// shares the sample of the gpu_pcie_tx metrics rather than sampling again for 20ms
+			if !pcieTXQueried {
+				gpuStat.PCIETXBytes, pcieTXRet = g.pcieThroughputBytes(nvml.PCIE_UTIL_TX_BYTES)
+				pcieTXQueried = true
+			}
+			if pcieTXRet == nvml.SUCCESS {
+				gpuStat.setProfiling(metric, float64(gpuStat.PCIETXBytes), ProfilingSourceNVML)
+			}
+		case GPU_PROF_PCIE_RX_BYTES:
+			if !pcieRXQueried {
+				gpuStat.PCIERXBytes, pcieRXRet = g.pcieThroughputBytes(nvml.PCIE_UTIL_RX_BYTES)
+				pcieRXQueried = true
+			}
+			if pcieRXRet == nvml.SUCCESS {
+				gpuStat.setProfiling(metric, float64(gpuStat.PCIERXBytes), ProfilingSourceNVML)
+			}
 		case GPU_MEMORY_FREE_BYTES:
 			gpuStat.MemoryFreeBytes = memoryInfo.Free
 		case GPU_MEMORY_USED_BYTES:
 			gpuStat.MemoryUsedBytes = memoryInfo.Used
+		case GPU_MEMORY_TOTAL_BYTES:
+			gpuStat.MemoryTotalBytes = memoryInfo.Total
+		case GPU_MEMORY_RESERVED_BYTES:
+			// free and used keep the v1 semantics, only reserved comes from v2
+			if memoryInfoV2, ret := g.GetMemoryInfo_v2(); ret == nvml.SUCCESS {
+				gpuStat.MemoryReservedBytes = memoryInfoV2.Reserved
+			}
+		case GPU_BAR1_TOTAL_BYTES, GPU_BAR1_USED_BYTES, GPU_BAR1_FREE_BYTES:
+			if !bar1Queried {
+				info, _ := g.GetBAR1MemoryInfo()
+				bar1Queried = true
+				gpuStat.BAR1TotalBytes = info.Bar1Total
+				gpuStat.BAR1UsedBytes = info.Bar1Used
+				gpuStat.BAR1FreeBytes = info.Bar1Free
+			}
 			// case GPU_NVLINK_RX_BYTES:
 			// 	rxCounter, _, _ := g.GetNvLinkUtilizationCounter(0,0)
 			// 	_, txCounter, _ := g.GetNvLinkUtilizationCounter(0,1)
@@ -172,7 +691,7 @@ func (g *GPUDevice) DeviceGetGPUStat(metrics []string) GPUStat {
 	return gpuStat
 }
 
-func (g *GPUDevice) GetProcessStat(useSlurm bool) map[uint]ProcessStat {
+func (g *GPUDevice) GetProcessStat(useSlurm bool, redaction *RedactionConfig) map[uint]ProcessStat {
 
 	retMap := make(map[uint]ProcessStat)
 	computeProcs, ret := g.GetComputeRunningProcesses()
@@ -196,14 +715,27 @@ func (g *GPUDevice) GetProcessStat(useSlurm bool) map[uint]ProcessStat {
 			GPUIndex:           int(g.GPUIndex),
 			GPUUsedMemoryBytes: proc.UsedGpuMemory,
 		}
-		err := ps.UpdateProcessInfoCPU(useSlurm)
+		err := ps.UpdateProcessInfoCPU(useSlurm, redaction)
 		if err != nil {
 			continue
 		}
+		if err := ps.UpdateProcessAffinity(); err != nil {
+			logrus.Debugf("cannot get affinity of pid:%d, err: %v", ps.Pid, err)
+		}
+		ps.NUMAMismatch = g.numaMismatch(&ps)
 		retMap[uint(proc.Pid)] = ps
 		// logrus.Infof("gpu:%d, psInfo:%+v", g.GPUIndex, ps)
 	}
 
+	// update encoder sessions
+	sessions, _ := g.GetEncoderSessions()
+	for _, session := range sessions {
+		if p, ok := retMap[uint(session.Pid)]; ok {
+			p.EncoderSessions++
+			retMap[uint(session.Pid)] = p
+		}
+	}
+
 	// update util
 	for _, proc := range utilProcs {
 		if proc.Pid < 1 {
@@ -221,7 +753,9 @@ func (g *GPUDevice) GetProcessStat(useSlurm bool) map[uint]ProcessStat {
 	return retMap
 }
 
-func (ps *ProcessStat) UpdateProcessInfoCPU(useSlurm bool) error {
+// UpdateProcessInfoCPU reads the process from /proc, redaction is applied to the
+// command line before it is stored, nil redacts nothing
+func (ps *ProcessStat) UpdateProcessInfoCPU(useSlurm bool, redaction *RedactionConfig) error {
 	proc, err := process.NewProcess(int32(ps.Pid))
 	if err != nil {
 		// logrus.Errorf("unable to get process, pid:%d", ps.Pid)
@@ -266,6 +800,7 @@ func (ps *ProcessStat) UpdateProcessInfoCPU(useSlurm bool) error {
 			}
 		}
 	}
+	redaction.redactProcess(ps)
 	return nil
 }
 
@@ -289,30 +824,91 @@ func (ps *ProcessStat) GetValueFromMetricName(metricName string) float64 {
 		return float64(ps.Encutil)
 	case PROCESS_GPU_MEM_USED_BYTES:
 		return float64(ps.GPUUsedMemoryBytes)
+	case PROCESS_GPU_ENCODER_SESSIONS:
+		return float64(ps.EncoderSessions)
+	case PROCESS_GPU_NUMA_MISMATCH:
+		if ps.NUMAMismatch {
+			return 1
+		}
+		return 0
 	default:
 		return 0
 	}
 }
 
+// HasValue reports whether the GPU reports metricName, unsupported values are
+// omitted rather than exported as 0
+func (gpu *GPUStat) HasValue(metricName string) bool {
+	switch metricName {
+	case GPU_MEMORY_TEMPERATURE:
+		return gpu.MemoryTemperature >= 0
+	case GPU_POWER_MIN_LIMIT:
+		return gpu.PowerMinLimit >= 0
+	case GPU_POWER_MAX_LIMIT:
+		return gpu.PowerMaxLimit >= 0
+	default:
+		return true
+	}
+}
+
 func (gpu *GPUStat) GetValueFromMetricName(metricName string) float64 {
 	// [x]: add value conversion from consts.go metricName
 	switch metricName {
+	case GPU_INFO, GPU_NUMA_INFO, GPU_TOPOLOGY_INFO:
+		return 1
+	case GPU_UP:
+		if gpu.Up {
+			return 1
+		}
+		return 0
 	case GPU_SM_CLOCK:
 		return float64(gpu.SMClock)
 	case GPU_MEMORY_CLOCK:
 		return float64(gpu.MemClock)
 	case GPU_TEMPERATURE:
 		return float64(gpu.Temperature)
-	case GPU_FAN_SPEED:
-		return float64(gpu.FanSpeed)
+	case GPU_MEMORY_TEMPERATURE:
+		return float64(gpu.MemoryTemperature)
+	case GPU_TEMPERATURE_SLOWDOWN_THRESHOLD:
+		return float64(gpu.TemperatureSlowdownThreshold)
+	case GPU_TEMPERATURE_SHUTDOWN_THRESHOLD:
+		return float64(gpu.TemperatureShutdownThreshold)
 	case GPU_POWER_USAGE:
-		return float64(gpu.PowerUsage)
+		return gpu.PowerUsage
 	case GPU_TOTAL_ENERGY_CONSUMPTION:
 		return float64(gpu.TotalEnergyConsumption)
-	case GPU_PCIE_TX_BYTES:
+	case GPU_POWER_LIMIT:
+		return gpu.PowerLimit
+	case GPU_POWER_DEFAULT_LIMIT:
+		return gpu.PowerDefaultLimit
+	case GPU_POWER_MIN_LIMIT:
+		return gpu.PowerMinLimit
+	case GPU_POWER_MAX_LIMIT:
+		return gpu.PowerMaxLimit
+	case GPU_POWER_MANAGEMENT_MODE:
+		return float64(gpu.PowerManagementMode)
+	case GPU_POWER_STATE:
+		return float64(gpu.PowerState)
+	case GPU_PCIE_TX_BYTES, GPU_PCIE_TX_BYTES_PER_SECOND:
 		return float64(gpu.PCIETXBytes)
-	case GPU_PCIE_RX_BYTES:
+	case GPU_PCIE_RX_BYTES, GPU_PCIE_RX_BYTES_PER_SECOND:
 		return float64(gpu.PCIERXBytes)
+	case GPU_PCIE_TX_BYTES_TOTAL:
+		return gpu.PCIETXBytesTotal
+	case GPU_PCIE_RX_BYTES_TOTAL:
+		return gpu.PCIERXBytesTotal
+	case GPU_PCIE_LINK_GEN_CURRENT:
+		return float64(gpu.PCIELinkGenCurrent)
+	case GPU_PCIE_LINK_GEN_MAX:
+		return float64(gpu.PCIELinkGenMax)
+	case GPU_PCIE_LINK_WIDTH_CURRENT:
+		return float64(gpu.PCIELinkWidthCurrent)
+	case GPU_PCIE_LINK_WIDTH_MAX:
+		return float64(gpu.PCIELinkWidthMax)
+	case GPU_PCIE_REPLAY_COUNTER:
+		return float64(gpu.PCIEReplayCounter)
+	case GPU_PCIE_LINK_DEGRADED:
+		return float64(gpu.PCIELinkDegraded)
 	case GPU_UTILIZATION:
 		return float64(gpu.GPUUtil)
 	case GPU_MEM_COPY_UTILIZATION:
@@ -321,11 +917,105 @@ func (gpu *GPUStat) GetValueFromMetricName(metricName string) float64 {
 		return float64(gpu.EncoderUtil)
 	case GPU_DEC_UTILIZATION:
 		return float64(gpu.DecoderUtil)
+	case GPU_ENCODER_SESSION_COUNT:
+		return float64(gpu.EncoderSessionCount)
+	case GPU_ENCODER_AVERAGE_FPS:
+		return float64(gpu.EncoderAverageFPS)
+	case GPU_ENCODER_AVERAGE_LATENCY:
+		return float64(gpu.EncoderAverageLatency)
+	case GPU_FBC_SESSION_COUNT:
+		return float64(gpu.FBCSessionCount)
+	case GPU_FBC_AVERAGE_FPS:
+		return float64(gpu.FBCAverageFPS)
+	case GPU_FBC_AVERAGE_LATENCY:
+		return float64(gpu.FBCAverageLatency)
 	case GPU_MEMORY_FREE_BYTES:
 		return float64(gpu.MemoryFreeBytes)
 	case GPU_MEMORY_USED_BYTES:
 		return float64(gpu.MemoryUsedBytes)
+	case GPU_MEMORY_TOTAL_BYTES:
+		return float64(gpu.MemoryTotalBytes)
+	case GPU_MEMORY_RESERVED_BYTES:
+		return float64(gpu.MemoryReservedBytes)
+	case GPU_BAR1_TOTAL_BYTES:
+		return float64(gpu.BAR1TotalBytes)
+	case GPU_BAR1_USED_BYTES:
+		return float64(gpu.BAR1UsedBytes)
+	case GPU_BAR1_FREE_BYTES:
+		return float64(gpu.BAR1FreeBytes)
 	default:
 		return 0
 	}
 }
+
+// GetLabeledValuesFromMetricName returns the series of metrics in
+// METRIC_EXTRA_LABELS, label values are in the order of the extra labels
+func (gpu *GPUStat) GetLabeledValuesFromMetricName(metricName string) []LabeledValue {
+	values := make([]LabeledValue, 0)
+	if IsProfilingMetric(metricName) {
+		if value, ok := gpu.Profiling[metricName]; ok {
+			values = append(values, LabeledValue{[]string{value.Source}, value.Value})
+		}
+		return values
+	}
+	switch metricName {
+	case GPU_DOWN_INFO:
+		if !gpu.Up {
+			values = append(values, LabeledValue{[]string{gpu.Error}, 1})
+		}
+		return values
+	case GPU_FAN_SPEED, GPU_FAN_TARGET_SPEED, GPU_FAN_CONTROL_POLICY:
+		for _, fan := range gpu.Fans {
+			value := fan.Speed
+			if metricName == GPU_FAN_TARGET_SPEED {
+				value = fan.TargetSpeed
+			} else if metricName == GPU_FAN_CONTROL_POLICY {
+				value = fan.ControlPolicy
+			}
+			// omit fans that do not report the value
+			if value >= 0 {
+				values = append(values, LabeledValue{[]string{fmt.Sprintf("%d", fan.Fan)}, float64(value)})
+			}
+		}
+		return values
+	}
+	for _, clock := range gpu.Clocks {
+		var value uint32
+		switch metricName {
+		case GPU_CLOCK_CURRENT:
+			// a current clock of 0 is valid, e.g. an idle video clock
+			values = append(values, LabeledValue{[]string{clock.Domain}, float64(clock.Current)})
+			continue
+		case GPU_CLOCK_VF_OFFSET, GPU_CLOCK_VF_OFFSET_MIN, GPU_CLOCK_VF_OFFSET_MAX:
+			if clock.HasVfOffset {
+				offset := clock.VfOffset
+				if metricName == GPU_CLOCK_VF_OFFSET_MIN {
+					offset = clock.VfOffsetMin
+				} else if metricName == GPU_CLOCK_VF_OFFSET_MAX {
+					offset = clock.VfOffsetMax
+				}
+				values = append(values, LabeledValue{[]string{clock.Domain}, float64(offset)})
+			}
+			continue
+		case GPU_CLOCK_MAX:
+			value = clock.Max
+		case GPU_CLOCK_APPLICATION:
+			value = clock.Application
+		case GPU_CLOCK_DEFAULT_APPLICATION:
+			value = clock.DefaultApplication
+		case GPU_CLOCK_BOOST_MAX:
+			value = clock.BoostMax
+		case GPU_CLOCK_PSTATE_MIN:
+			value = clock.PStateMin
+		case GPU_CLOCK_PSTATE_MAX:
+			value = clock.PStateMax
+		default:
+			return values
+		}
+		// omit domains the device does not report
+		if value > 0 {
+			values = append(values, LabeledValue{[]string{clock.Domain}, float64(value)})
+		}
+	}
+	return values
+}
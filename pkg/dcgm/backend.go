@@ -0,0 +1,71 @@
+package dcgm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+	"github.com/sirupsen/logrus"
+)
+
+// HostEngine is the connection to a DCGM host engine (nv-hostengine). It is
+// implemented with go-dcgm when built with `-tags dcgm`, and by FakeHostEngine.
+type HostEngine interface {
+	// Watch makes the host engine sample fields on all GPUs every interval
+	Watch(fields []string, interval time.Duration) error
+	// LatestValues returns the last sample of fields on the GPU, fields
+	// without a value (blank or not supported) are left out
+	LatestValues(uuid string, fields []string) (map[string]float64, error)
+	Close() error
+}
+
+// Backend reads the profiling metrics from a DCGM host engine, it implements
+// collector.ProfilingBackend
+type Backend struct {
+	engine HostEngine
+}
+
+// Connect connects to the host engine at address, e.g. localhost:5555, and
+// watches the fields of the profiling metrics among metrics. It fails when the exporter is built without
+// DCGM support, the host engine is not running or the GPUs have no profiling
+// support, callers should then keep the NVML metrics.
+func Connect(address string, interval time.Duration, metrics []string) (*Backend, error) {
+	engine, err := newHostEngine(address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to dcgm host engine %v, err: %v", address, err)
+	}
+	backend, err := NewBackend(engine, interval, metrics)
+	if err != nil {
+		engine.Close()
+		return nil, err
+	}
+	logrus.Infof("DCGM profiling metrics enabled, host engine: %v", address)
+	return backend, nil
+}
+
+// NewBackend watches the fields of the profiling metrics among metrics on engine
+func NewBackend(engine HostEngine, interval time.Duration, metrics []string) (*Backend, error) {
+	if err := engine.Watch(profilingFields(metrics), interval); err != nil {
+		return nil, fmt.Errorf("cannot watch dcgm profiling fields, err: %v", err)
+	}
+	return &Backend{engine: engine}, nil
+}
+
+func (b *Backend) GetProfilingValues(uuid string, fields []string) (map[string]float64, error) {
+	return b.engine.LatestValues(uuid, fields)
+}
+
+func (b *Backend) Close() error {
+	return b.engine.Close()
+}
+
+// profilingFields are the DCGM fields of the profiling metrics among metrics
+func profilingFields(metrics []string) []string {
+	fields := make([]string, 0, len(collector.DCGM_PROFILING_FIELDS))
+	for _, metric := range metrics {
+		if field, ok := collector.DCGM_PROFILING_FIELDS[metric]; ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
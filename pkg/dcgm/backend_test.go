@@ -0,0 +1,82 @@
+package dcgm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+)
+
+func TestNewBackend(t *testing.T) {
+	engine := NewFakeHostEngine()
+	backend, err := NewBackend(engine, 5*time.Second, collector.SupportedGGPUMetricsName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if engine.Interval != 5*time.Second {
+		t.Errorf("watch interval %v, want 5s", engine.Interval)
+	}
+	watched := make(map[string]bool)
+	for _, field := range engine.Watched {
+		watched[field] = true
+	}
+	for metric, field := range collector.DCGM_PROFILING_FIELDS {
+		if !watched[field] {
+			t.Errorf("%v of %v is not watched", field, metric)
+		}
+	}
+
+	if err := backend.Close(); err != nil || !engine.Closed {
+		t.Errorf("close: %v, closed: %v", err, engine.Closed)
+	}
+}
+
+func TestNewBackendWatchError(t *testing.T) {
+	engine := NewFakeHostEngine()
+	engine.Err = errors.New("profiling not supported")
+	if _, err := NewBackend(engine, time.Second, collector.SupportedGGPUMetricsName); err == nil {
+		t.Error("NewBackend succeeded although the fields cannot be watched")
+	}
+}
+
+func TestGetProfilingValues(t *testing.T) {
+	engine := NewFakeHostEngine()
+	engine.Set("GPU-a", "DCGM_FI_PROF_SM_ACTIVE", 0.4)
+	backend, err := NewBackend(engine, time.Second, collector.SupportedGGPUMetricsName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := backend.GetProfilingValues("GPU-a", []string{"DCGM_FI_PROF_SM_ACTIVE", "DCGM_FI_PROF_PIPE_FP64_ACTIVE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["DCGM_FI_PROF_SM_ACTIVE"] != 0.4 {
+		t.Errorf("SM_ACTIVE %v, want 0.4", values["DCGM_FI_PROF_SM_ACTIVE"])
+	}
+	if _, ok := values["DCGM_FI_PROF_PIPE_FP64_ACTIVE"]; ok {
+		t.Error("unsupported field has a value")
+	}
+
+	engine.Err = errors.New("connection lost")
+	if _, err := backend.GetProfilingValues("GPU-a", []string{"DCGM_FI_PROF_SM_ACTIVE"}); err == nil {
+		t.Error("no error from a failing host engine")
+	}
+}
+
+func TestNewBackendConfiguredMetrics(t *testing.T) {
+	engine := NewFakeHostEngine()
+	metrics := []string{collector.GPU_TEMPERATURE, collector.GPU_PROF_SM_ACTIVE, collector.GPU_PROF_PCIE_TX_BYTES}
+	if _, err := NewBackend(engine, time.Second, metrics); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		collector.DCGM_PROFILING_FIELDS[collector.GPU_PROF_SM_ACTIVE],
+		collector.DCGM_PROFILING_FIELDS[collector.GPU_PROF_PCIE_TX_BYTES],
+	}
+	if !reflect.DeepEqual(engine.Watched, want) {
+		t.Errorf("watched %v, want %v", engine.Watched, want)
+	}
+}
@@ -0,0 +1,71 @@
+package dcgm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakeHostEngine is an in-memory HostEngine, values are set with Set and Err
+// makes every call fail, e.g. to simulate a host engine that went away
+type FakeHostEngine struct {
+	sync.Mutex
+	Err error
+	// fields and interval of the last Watch
+	Watched  []string
+	Interval time.Duration
+	Closed   bool
+
+	values map[string]map[string]float64
+}
+
+func NewFakeHostEngine() *FakeHostEngine {
+	return &FakeHostEngine{values: make(map[string]map[string]float64)}
+}
+
+// Set sets the latest value of field on the GPU
+func (f *FakeHostEngine) Set(uuid string, field string, value float64) {
+	f.Lock()
+	defer f.Unlock()
+	if f.values[uuid] == nil {
+		f.values[uuid] = make(map[string]float64)
+	}
+	f.values[uuid][field] = value
+}
+
+func (f *FakeHostEngine) Watch(fields []string, interval time.Duration) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Watched = append([]string{}, fields...)
+	f.Interval = interval
+	return nil
+}
+
+func (f *FakeHostEngine) LatestValues(uuid string, fields []string) (map[string]float64, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	gpu, ok := f.values[uuid]
+	if !ok {
+		return nil, fmt.Errorf("unknown gpu %v", uuid)
+	}
+	values := make(map[string]float64)
+	for _, field := range fields {
+		if value, ok := gpu[field]; ok {
+			values[field] = value
+		}
+	}
+	return values, nil
+}
+
+func (f *FakeHostEngine) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	f.Closed = true
+	return nil
+}
@@ -0,0 +1,127 @@
+//go:build dcgm
+
+package dcgm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	godcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+)
+
+const (
+	// values at or above these are DCGM blank values, e.g. not supported
+	dcgmInt64Blank   = 0x7ffffff0
+	dcgmFloat64Blank = 140737488355328.0
+)
+
+// hostEngine talks to nv-hostengine through go-dcgm
+type hostEngine struct {
+	sync.Mutex
+	cleanup    func()
+	fieldGroup *godcgm.FieldHandle
+	// dcgm gpu id by uuid
+	gpuIDs map[string]uint
+}
+
+func newHostEngine(address string) (HostEngine, error) {
+	cleanup, err := godcgm.Init(godcgm.Standalone, address, "0")
+	if err != nil {
+		return nil, err
+	}
+	e := &hostEngine{cleanup: cleanup, gpuIDs: make(map[string]uint)}
+	gpus, err := godcgm.GetSupportedDevices()
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("cannot list dcgm gpus, err: %v", err)
+	}
+	for _, gpu := range gpus {
+		device, err := godcgm.GetDeviceInfo(gpu)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("cannot get dcgm gpu %d, err: %v", gpu, err)
+		}
+		e.gpuIDs[device.UUID] = gpu
+	}
+	return e, nil
+}
+
+func fieldIDs(fields []string) ([]godcgm.Short, error) {
+	ids := make([]godcgm.Short, 0, len(fields))
+	for _, field := range fields {
+		id, ok := godcgm.DCGM_FI[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown dcgm field %v", field)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (e *hostEngine) Watch(fields []string, interval time.Duration) error {
+	e.Lock()
+	defer e.Unlock()
+	ids, err := fieldIDs(fields)
+	if err != nil {
+		return err
+	}
+	group, err := godcgm.FieldGroupCreate(fmt.Sprintf("nvml-exporter-%d", time.Now().UnixNano()), ids)
+	if err != nil {
+		return err
+	}
+	// keep a few samples so a value is always there between two updates
+	err = godcgm.WatchFieldsWithGroupEx(group, godcgm.GroupAllGPUs(), interval.Microseconds(), 3*interval.Seconds(), 0)
+	if err != nil {
+		godcgm.FieldGroupDestroy(group)
+		return err
+	}
+	if e.fieldGroup != nil {
+		godcgm.FieldGroupDestroy(*e.fieldGroup)
+	}
+	e.fieldGroup = &group
+	return nil
+}
+
+func (e *hostEngine) LatestValues(uuid string, fields []string) (map[string]float64, error) {
+	gpu, ok := e.gpuIDs[uuid]
+	if !ok {
+		return nil, fmt.Errorf("gpu %v is not managed by dcgm", uuid)
+	}
+	ids, err := fieldIDs(fields)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := godcgm.GetLatestValuesForFields(gpu, ids)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]float64)
+	for i, sample := range samples {
+		if i >= len(fields) || sample.Status != 0 {
+			continue
+		}
+		switch sample.FieldType {
+		case godcgm.DCGM_FT_DOUBLE:
+			if v := sample.Float64(); v < dcgmFloat64Blank {
+				values[fields[i]] = v
+			}
+		case godcgm.DCGM_FT_INT64:
+			if v := sample.Int64(); v < dcgmInt64Blank {
+				values[fields[i]] = float64(v)
+			}
+		}
+	}
+	return values, nil
+}
+
+func (e *hostEngine) Close() error {
+	e.Lock()
+	defer e.Unlock()
+	if e.fieldGroup != nil {
+		godcgm.FieldGroupDestroy(*e.fieldGroup)
+		e.fieldGroup = nil
+	}
+	e.cleanup()
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !dcgm
+
+package dcgm
+
+import "fmt"
+
+func newHostEngine(address string) (HostEngine, error) {
+	return nil, fmt.Errorf("nvml-exporter is built without dcgm support, rebuild with -tags dcgm")
+}
@@ -5,16 +5,20 @@ import (
 	"net/http"
 
 	"github.com/nvml-exporter/pkg/collector"
+	"github.com/nvml-exporter/pkg/jobreport"
 )
 
 // todo: server
 type DebugHandler struct {
 	cache *collector.NVMLCache
+	jobs  *jobreport.Tracker
 }
 
-func HandlerFor(cache *collector.NVMLCache) http.Handler {
+// HandlerFor serves the cache content as json, jobs may be nil
+func HandlerFor(cache *collector.NVMLCache, jobs *jobreport.Tracker) http.Handler {
 	return DebugHandler{
 		cache: cache,
+		jobs:  jobs,
 	}
 }
 
@@ -28,6 +32,10 @@ func (h DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleGPUStat(w, r)
 	case "/debug/process":
 		h.handleProcess(w, r)
+	case "/debug/jobs":
+		h.handleJobs(w, r)
+	case "/debug/topology":
+		h.handleTopology(w, r)
 	default:
 		http.NotFound(w, r)
 	}
@@ -51,6 +59,22 @@ func (h DebugHandler) handleProcess(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, info)
 }
 
+func (h DebugHandler) handleJobs(w http.ResponseWriter, r *http.Request) {
+	// 处理 /debug/jobs 请求
+	if h.jobs == nil {
+		http.Error(w, "job report is disabled, run with -use-slurm", http.StatusNotFound)
+		return
+	}
+	info := h.jobs.GetRecentJobs()
+	jsonResponse(w, info)
+}
+
+func (h DebugHandler) handleTopology(w http.ResponseWriter, r *http.Request) {
+	// 处理 /debug/topology 请求
+	info := h.cache.GetTopology()
+	jsonResponse(w, info)
+}
+
 func jsonResponse(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
@@ -0,0 +1,353 @@
+package jobreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+	"github.com/sirupsen/logrus"
+)
+
+// GPUUsage is the part of a job that ran on one GPU
+type GPUUsage struct {
+	GPUIndex           int     `json:"gpu"`
+	UUID               string  `json:"UUID"`
+	Samples            int     `json:"samples"`
+	MeanSMUtil         float64 `json:"meanSMUtil"`
+	MaxSMUtil          float64 `json:"maxSMUtil"`
+	PeakGPUMemoryBytes uint64  `json:"peakGPUMemoryBytes"`
+	EnergyJoules       float64 `json:"energyJoules"`
+
+	smUtilSum float64
+}
+
+// JobSummary is emitted once all processes of a slurm job left the GPUs for
+// longer than Config.Grace
+type JobSummary struct {
+	JobID    string `json:"slurmJobID"`
+	User     string `json:"slurmUser"`
+	Account  string `json:"slurmAccount"`
+	JobName  string `json:"slurmJobName"`
+	Hostname string `json:"hostname"`
+
+	FirstSeen       time.Time `json:"firstSeen"`
+	LastSeen        time.Time `json:"lastSeen"`
+	DurationSeconds float64   `json:"durationSeconds"` // from first to last seen on GPU
+	Samples         int       `json:"samples"`
+
+	MeanSMUtil         float64 `json:"meanSMUtil"` // mean over GPUs and samples (in %)
+	MaxSMUtil          float64 `json:"maxSMUtil"`
+	PeakGPUMemoryBytes uint64  `json:"peakGPUMemoryBytes"` // summed over GPUs at the same sample
+	// EnergyJoules is the GPU energy apportioned to the job by its share of
+	// SM utilization when GPUs are shared, an estimate only.
+	EnergyJoules float64    `json:"energyJoules"`
+	GPUs         []GPUUsage `json:"gpus"`
+
+	gpus map[int]*GPUUsage
+}
+
+type Config struct {
+	Dir  string // write one json file per finished job, disabled if empty
+	Keep int    // number of recent summaries served on /debug/jobs
+	// a job is finished once it has not been seen for Grace, so that gaps,
+	// e.g. between srun steps or a missed utilization sample, do not split it
+	Grace time.Duration
+}
+
+// Tracker follows slurm jobs across NVMLCache snapshots
+type Tracker struct {
+	sync.Mutex
+	config Config
+	cache  *collector.NVMLCache
+	active map[string]*JobSummary
+	recent []JobSummary
+
+	lastTime   time.Time
+	lastEnergy map[int]uint64
+}
+
+func NewTracker(config Config, cache *collector.NVMLCache) (*Tracker, error) {
+	if config.Keep <= 0 {
+		config.Keep = 100
+	}
+	if config.Grace <= 0 {
+		config.Grace = 2 * time.Minute
+	}
+	if config.Dir != "" {
+		if err := os.MkdirAll(config.Dir, 0755); err != nil {
+			return nil, fmt.Errorf("cannot create job report dir, err: %v", err)
+		}
+	}
+	return &Tracker{
+		config:     config,
+		cache:      cache,
+		active:     make(map[string]*JobSummary),
+		recent:     make([]JobSummary, 0),
+		lastEnergy: make(map[int]uint64),
+	}, nil
+}
+
+type jobGPUSample struct {
+	smUtil float64
+	memory uint64
+}
+
+// OnUpdate is meant to be registered as an NVMLCache update hook
+func (t *Tracker) OnUpdate() {
+	now := t.cache.GetLastUpdate()
+	gpuStats := t.cache.GetGPUStats()
+	processStats := t.cache.GetProcessStats()
+
+	// job -> gpu -> usage in this sample
+	samples := make(map[string]map[int]*jobGPUSample)
+	for _, ps := range processStats {
+		if ps.SlurmJobID == "" {
+			continue
+		}
+		job, ok := t.active[ps.SlurmJobID]
+		if !ok {
+			job = &JobSummary{
+				JobID:     ps.SlurmJobID,
+				User:      ps.SlurmUser,
+				Account:   ps.SlurmAccount,
+				JobName:   ps.SlurmJobName,
+				Hostname:  t.cache.Hostname,
+				FirstSeen: now,
+				gpus:      make(map[int]*GPUUsage),
+			}
+			t.active[ps.SlurmJobID] = job
+		}
+		if samples[ps.SlurmJobID] == nil {
+			samples[ps.SlurmJobID] = make(map[int]*jobGPUSample)
+		}
+		s, ok := samples[ps.SlurmJobID][ps.GPUIndex]
+		if !ok {
+			s = &jobGPUSample{}
+			samples[ps.SlurmJobID][ps.GPUIndex] = s
+		}
+		s.smUtil += float64(ps.Smutil)
+		s.memory += ps.GPUUsedMemoryBytes
+	}
+
+	gpuEnergy := t.gpuEnergy(now, gpuStats)
+	// SM utilization of all jobs per gpu, used to split energy
+	gpuSMUtil := make(map[int]float64)
+	gpuJobs := make(map[int]int)
+	for _, perGPU := range samples {
+		for gpu, s := range perGPU {
+			if s.smUtil > 100 {
+				s.smUtil = 100
+			}
+			gpuSMUtil[gpu] += s.smUtil
+			gpuJobs[gpu]++
+		}
+	}
+
+	for jobID, perGPU := range samples {
+		job := t.active[jobID]
+		job.LastSeen = now
+		job.Samples++
+		var memory uint64
+		for gpu, s := range perGPU {
+			usage, ok := job.gpus[gpu]
+			if !ok {
+				usage = &GPUUsage{GPUIndex: gpu, UUID: gpuUUID(gpuStats, gpu)}
+				job.gpus[gpu] = usage
+			}
+			usage.Samples++
+			usage.smUtilSum += s.smUtil
+			if s.smUtil > usage.MaxSMUtil {
+				usage.MaxSMUtil = s.smUtil
+			}
+			if s.memory > usage.PeakGPUMemoryBytes {
+				usage.PeakGPUMemoryBytes = s.memory
+			}
+			share := 1 / float64(gpuJobs[gpu])
+			if gpuSMUtil[gpu] > 0 {
+				share = s.smUtil / gpuSMUtil[gpu]
+			}
+			usage.EnergyJoules += gpuEnergy[gpu] * share
+			memory += s.memory
+		}
+		if memory > job.PeakGPUMemoryBytes {
+			job.PeakGPUMemoryBytes = memory
+		}
+	}
+
+	for jobID, job := range t.active {
+		if now.Sub(job.LastSeen) < t.config.Grace {
+			continue
+		}
+		delete(t.active, jobID)
+		t.finish(job)
+	}
+}
+
+// gpuEnergy returns the energy in J every gpu used since the previous update,
+// from the energy counter when collected, otherwise from power draw.
+func (t *Tracker) gpuEnergy(now time.Time, gpuStats []collector.GPUStat) map[int]float64 {
+	energy := make(map[int]float64)
+	interval := now.Sub(t.lastTime).Seconds()
+	for _, gpu := range gpuStats {
+		idx := int(gpu.GPUIndex)
+		last, ok := t.lastEnergy[idx]
+		switch {
+		case ok && gpu.TotalEnergyConsumption > last:
+			energy[idx] = float64(gpu.TotalEnergyConsumption-last) / 1000
+		case !t.lastTime.IsZero():
+			energy[idx] = gpu.PowerUsage * interval
+		}
+		if gpu.TotalEnergyConsumption > 0 {
+			t.lastEnergy[idx] = gpu.TotalEnergyConsumption
+		}
+	}
+	t.lastTime = now
+	return energy
+}
+
+func (t *Tracker) finish(job *JobSummary) {
+	// a job seen again after the grace period extends its earlier report
+	if prev := t.previous(job); prev != nil {
+		job.merge(prev)
+	}
+	job.DurationSeconds = job.LastSeen.Sub(job.FirstSeen).Seconds()
+	var smUtilSum float64
+	var gpuSamples int
+	for _, usage := range job.gpus {
+		usage.MeanSMUtil = usage.smUtilSum / float64(usage.Samples)
+		smUtilSum += usage.smUtilSum
+		gpuSamples += usage.Samples
+		if usage.MaxSMUtil > job.MaxSMUtil {
+			job.MaxSMUtil = usage.MaxSMUtil
+		}
+		job.EnergyJoules += usage.EnergyJoules
+		job.GPUs = append(job.GPUs, *usage)
+	}
+	if gpuSamples > 0 {
+		job.MeanSMUtil = smUtilSum / float64(gpuSamples)
+	}
+	sort.Slice(job.GPUs, func(i, j int) bool { return job.GPUs[i].GPUIndex < job.GPUs[j].GPUIndex })
+	logrus.Infof("Slurm job %v finished on GPUs after %.0fs", job.JobID, job.DurationSeconds)
+
+	t.Lock()
+	for i := range t.recent {
+		if t.recent[i].JobID == job.JobID {
+			t.recent = append(t.recent[:i], t.recent[i+1:]...)
+			break
+		}
+	}
+	t.recent = append(t.recent, *job)
+	if len(t.recent) > t.config.Keep {
+		t.recent = t.recent[len(t.recent)-t.config.Keep:]
+	}
+	t.Unlock()
+
+	if t.config.Dir != "" {
+		if err := t.write(job); err != nil {
+			logrus.Errorf("Failed to write report of job %v: %v", job.JobID, err)
+		}
+	}
+}
+
+// previous returns the earlier report of the job, from the recent summaries or
+// the report dir, nil if there is none
+func (t *Tracker) previous(job *JobSummary) *JobSummary {
+	t.Lock()
+	for i := range t.recent {
+		if t.recent[i].JobID == job.JobID {
+			prev := t.recent[i]
+			t.Unlock()
+			return &prev
+		}
+	}
+	t.Unlock()
+	if t.config.Dir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(t.config.Dir, reportName(job)))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Errorf("Failed to read report of job %v: %v", job.JobID, err)
+		}
+		return nil
+	}
+	prev := &JobSummary{}
+	if err := json.Unmarshal(data, prev); err != nil {
+		logrus.Errorf("Failed to parse report of job %v, it is overwritten: %v", job.JobID, err)
+		return nil
+	}
+	return prev
+}
+
+// merge adds the usage of an earlier report of the job, before the totals are
+// computed by finish
+func (job *JobSummary) merge(prev *JobSummary) {
+	if !prev.FirstSeen.IsZero() && prev.FirstSeen.Before(job.FirstSeen) {
+		job.FirstSeen = prev.FirstSeen
+	}
+	if prev.LastSeen.After(job.LastSeen) {
+		job.LastSeen = prev.LastSeen
+	}
+	job.Samples += prev.Samples
+	if prev.PeakGPUMemoryBytes > job.PeakGPUMemoryBytes {
+		job.PeakGPUMemoryBytes = prev.PeakGPUMemoryBytes
+	}
+	for _, p := range prev.GPUs {
+		usage, ok := job.gpus[p.GPUIndex]
+		if !ok {
+			usage = &GPUUsage{GPUIndex: p.GPUIndex, UUID: p.UUID}
+			job.gpus[p.GPUIndex] = usage
+		}
+		usage.Samples += p.Samples
+		usage.smUtilSum += p.MeanSMUtil * float64(p.Samples)
+		if p.MaxSMUtil > usage.MaxSMUtil {
+			usage.MaxSMUtil = p.MaxSMUtil
+		}
+		if p.PeakGPUMemoryBytes > usage.PeakGPUMemoryBytes {
+			usage.PeakGPUMemoryBytes = p.PeakGPUMemoryBytes
+		}
+		usage.EnergyJoules += p.EnergyJoules
+	}
+}
+
+func reportName(job *JobSummary) string {
+	return fmt.Sprintf("%s-%s.json", job.JobID, job.Hostname)
+}
+
+func (t *Tracker) write(job *JobSummary) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := reportName(job)
+	tmp := filepath.Join(t.config.Dir, "."+name+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.config.Dir, name))
+}
+
+// GetRecentJobs returns the most recent summaries, newest first
+func (t *Tracker) GetRecentJobs() []JobSummary {
+	t.Lock()
+	defer t.Unlock()
+	snapshot := make([]JobSummary, len(t.recent))
+	for i, job := range t.recent {
+		snapshot[len(t.recent)-1-i] = job
+	}
+	return snapshot
+}
+
+func gpuUUID(gpuStats []collector.GPUStat, gpuIndex int) string {
+	for _, gpu := range gpuStats {
+		if int(gpu.GPUIndex) == gpuIndex {
+			return gpu.UUID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,205 @@
+package jobreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// step is one NVMLCache snapshot, 5s after the previous one
+type step struct {
+	gpus  []collector.GPUStat
+	procs []collector.ProcessStat
+}
+
+func gpu(index uint, energy uint64, power float64) collector.GPUStat {
+	return collector.GPUStat{GPUIndex: index, UUID: fmt.Sprintf("GPU-%d", index), Up: true,
+		TotalEnergyConsumption: energy, PowerUsage: power}
+}
+
+func proc(pid uint32, gpu int, jobID string, smUtil uint32, memory uint64) collector.ProcessStat {
+	ps := collector.ProcessStat{Pid: pid, GPUIndex: gpu, Smutil: smUtil, GPUUsedMemoryBytes: memory}
+	ps.SlurmJobID = jobID
+	ps.SlurmUser = "alice"
+	return ps
+}
+
+// run feeds the steps to a new tracker and returns it with the time of the
+// last step
+func run(t *testing.T, config Config, steps []step) (*Tracker, time.Time) {
+	t.Helper()
+	cache := &collector.NVMLCache{Hostname: "node1"}
+	tracker, err := NewTracker(config, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := start
+	for _, s := range steps {
+		now = now.Add(5 * time.Second)
+		feed(tracker, cache, now, s)
+	}
+	return tracker, now
+}
+
+func feed(tracker *Tracker, cache *collector.NVMLCache, now time.Time, s step) {
+	cache.LastUpdate = now
+	cache.GPUStats = s.gpus
+	cache.ProcessStats = make(map[string]collector.ProcessStat)
+	for _, ps := range s.procs {
+		cache.ProcessStats[fmt.Sprintf("%d", ps.Pid)] = ps
+	}
+	tracker.OnUpdate()
+}
+
+func jobs(tracker *Tracker) map[string]JobSummary {
+	summaries := make(map[string]JobSummary)
+	for _, job := range tracker.GetRecentJobs() {
+		summaries[job.JobID] = job
+	}
+	return summaries
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestJobSummary(t *testing.T) {
+	// two steps on the gpu, then long enough without the jobs to finish them
+	gone := []step{{gpus: []collector.GPUStat{gpu(0, 0, 0)}}, {gpus: []collector.GPUStat{gpu(0, 0, 0)}}}
+	tests := []struct {
+		name   string
+		steps  []step
+		energy map[string]float64 // J per job
+		smUtil map[string]float64 // max SM util per job
+	}{
+		{"energy counter split by sm util", []step{
+			{gpus: []collector.GPUStat{gpu(0, 1000000, 0)}, procs: []collector.ProcessStat{proc(1, 0, "100", 60, 1<<30), proc(2, 0, "200", 20, 1<<30)}},
+			{gpus: []collector.GPUStat{gpu(0, 1400000, 0)}, procs: []collector.ProcessStat{proc(1, 0, "100", 60, 1<<30), proc(2, 0, "200", 20, 1<<30)}},
+		}, map[string]float64{"100": 300, "200": 100}, map[string]float64{"100": 60, "200": 20}},
+		{"power fallback", []step{
+			{gpus: []collector.GPUStat{gpu(0, 0, 200)}, procs: []collector.ProcessStat{proc(1, 0, "100", 50, 0)}},
+			{gpus: []collector.GPUStat{gpu(0, 0, 200)}, procs: []collector.ProcessStat{proc(1, 0, "100", 50, 0)}},
+		}, map[string]float64{"100": 1000}, map[string]float64{"100": 50}},
+		{"idle gpu split evenly", []step{
+			{gpus: []collector.GPUStat{gpu(0, 0, 100)}, procs: []collector.ProcessStat{proc(1, 0, "100", 0, 0), proc(2, 0, "200", 0, 0)}},
+			{gpus: []collector.GPUStat{gpu(0, 0, 100)}, procs: []collector.ProcessStat{proc(1, 0, "100", 0, 0), proc(2, 0, "200", 0, 0)}},
+		}, map[string]float64{"100": 250, "200": 250}, map[string]float64{"100": 0, "200": 0}},
+		{"sm util capped per gpu", []step{
+			{gpus: []collector.GPUStat{gpu(0, 0, 0)}, procs: []collector.ProcessStat{proc(1, 0, "100", 80, 0), proc(2, 0, "100", 70, 0)}},
+		}, map[string]float64{"100": 0}, map[string]float64{"100": 100}},
+		{"gpus counted separately", []step{
+			{gpus: []collector.GPUStat{gpu(0, 1000, 0), gpu(1, 1000, 0)}, procs: []collector.ProcessStat{proc(1, 0, "100", 10, 0), proc(2, 1, "100", 90, 0)}},
+			{gpus: []collector.GPUStat{gpu(0, 3000, 0), gpu(1, 5000, 0)}, procs: []collector.ProcessStat{proc(1, 0, "100", 10, 0), proc(2, 1, "100", 90, 0)}},
+		}, map[string]float64{"100": 6}, map[string]float64{"100": 90}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, _ := run(t, Config{Grace: 10 * time.Second}, append(tt.steps, gone...))
+			summaries := jobs(tracker)
+			if len(summaries) != len(tt.energy) {
+				t.Fatalf("%d jobs finished, want %d", len(summaries), len(tt.energy))
+			}
+			for jobID, want := range tt.energy {
+				job := summaries[jobID]
+				if !almostEqual(job.EnergyJoules, want) {
+					t.Errorf("job %v: %v J, want %v J", jobID, job.EnergyJoules, want)
+				}
+				if job.MaxSMUtil != tt.smUtil[jobID] {
+					t.Errorf("job %v: max sm util %v, want %v", jobID, job.MaxSMUtil, tt.smUtil[jobID])
+				}
+				if job.Samples != len(tt.steps) {
+					t.Errorf("job %v: %d samples, want %d", jobID, job.Samples, len(tt.steps))
+				}
+			}
+		})
+	}
+}
+
+func TestJobGrace(t *testing.T) {
+	running := step{gpus: []collector.GPUStat{gpu(0, 0, 100)}, procs: []collector.ProcessStat{proc(1, 0, "100", 40, 2<<30)}}
+	idle := step{gpus: []collector.GPUStat{gpu(0, 0, 100)}}
+
+	// gone for one update, e.g. between srun steps
+	tracker, _ := run(t, Config{Grace: 10 * time.Second}, []step{running, idle, running})
+	if len(tracker.GetRecentJobs()) != 0 {
+		t.Fatal("job finished within the grace period")
+	}
+
+	tracker, now := run(t, Config{Grace: 10 * time.Second}, []step{running, idle, running, idle, idle})
+	summaries := tracker.GetRecentJobs()
+	if len(summaries) != 1 {
+		t.Fatalf("%d summaries, want 1", len(summaries))
+	}
+	job := summaries[0]
+	if job.Samples != 2 || job.DurationSeconds != 10 || job.PeakGPUMemoryBytes != 2<<30 {
+		t.Errorf("samples %d, duration %v, peak memory %d", job.Samples, job.DurationSeconds, job.PeakGPUMemoryBytes)
+	}
+	if !job.LastSeen.Equal(now.Add(-10 * time.Second)) {
+		t.Errorf("last seen %v", job.LastSeen)
+	}
+}
+
+func TestJobReportMerge(t *testing.T) {
+	dir := t.TempDir()
+	running := step{gpus: []collector.GPUStat{gpu(0, 0, 100)}, procs: []collector.ProcessStat{proc(1, 0, "100", 40, 1<<30)}}
+	idle := step{gpus: []collector.GPUStat{gpu(0, 0, 100)}}
+	steps := []step{running, running, idle, idle, idle}
+
+	// the same job comes back after its report, on a restarted exporter
+	run(t, Config{Dir: dir, Grace: 10 * time.Second}, steps)
+	running.procs = []collector.ProcessStat{proc(1, 0, "100", 80, 3<<30)}
+	steps = []step{running, running, idle, idle, idle}
+	cache := &collector.NVMLCache{Hostname: "node1"}
+	tracker, err := NewTracker(Config{Dir: dir, Grace: 10 * time.Second}, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := start.Add(time.Hour)
+	for _, s := range steps {
+		now = now.Add(5 * time.Second)
+		feed(tracker, cache, now, s)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "100-node1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job JobSummary
+	if err := json.Unmarshal(data, &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Samples != 4 || !job.FirstSeen.Equal(start.Add(5*time.Second)) {
+		t.Errorf("samples %d, first seen %v, want 4 and %v", job.Samples, job.FirstSeen, start.Add(5*time.Second))
+	}
+	// 500 J per run, the first sample of each run has no interval
+	if !almostEqual(job.EnergyJoules, 1000) {
+		t.Errorf("energy %v J, want 1000 J", job.EnergyJoules)
+	}
+	if job.MeanSMUtil != 60 || job.MaxSMUtil != 80 || job.PeakGPUMemoryBytes != 3<<30 {
+		t.Errorf("mean sm util %v, max %v, peak memory %d", job.MeanSMUtil, job.MaxSMUtil, job.PeakGPUMemoryBytes)
+	}
+	if len(job.GPUs) != 1 || job.GPUs[0].Samples != 4 {
+		t.Errorf("gpus %+v", job.GPUs)
+	}
+}
+
+func TestJobReportKeep(t *testing.T) {
+	steps := make([]step, 0)
+	for _, jobID := range []string{"1", "2", "3"} {
+		steps = append(steps, step{gpus: []collector.GPUStat{gpu(0, 0, 0)}, procs: []collector.ProcessStat{proc(1, 0, jobID, 10, 0)}})
+	}
+	steps = append(steps, step{gpus: []collector.GPUStat{gpu(0, 0, 0)}})
+	tracker, _ := run(t, Config{Keep: 2, Grace: time.Second}, steps)
+	summaries := tracker.GetRecentJobs()
+	if len(summaries) != 2 || summaries[0].JobID != "3" || summaries[1].JobID != "2" {
+		t.Errorf("recent jobs %+v, want 3 and 2", summaries)
+	}
+}
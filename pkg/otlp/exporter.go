@@ -0,0 +1,293 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+
+	scopeName = "github.com/nvml-exporter"
+)
+
+// Config is the `otlp` section of the metric config file
+type Config struct {
+	Endpoint string            `yaml:"endpoint"` // host:port for grpc, url or host:port for http
+	Protocol string            `yaml:"protocol"` // grpc (default) or http
+	Insecure bool              `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	Timeout  int               `yaml:"timeout"` // export timeout in seconds
+}
+
+// Exporter pushes every NVMLCache snapshot to an OTLP receiver. Each GPU is
+// a resource, processes are grouped into one resource per GPU and slurm job.
+type Exporter struct {
+	config         Config
+	cache          *collector.NVMLCache
+	useSlurm       bool
+	cardinality    collector.CardinalityConfig
+	gpuMetrics     []string
+	processMetrics []string
+	transport      transport
+	startTime      time.Time
+	pending        chan struct{}
+	done           chan struct{}
+}
+
+// NewExporter must be called after the collectors are created, it exports the
+// same metric set as the prometheus endpoint.
+func NewExporter(config Config, collectorConfig *collector.Config, cache *collector.NVMLCache) (*Exporter, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = 10
+	}
+	var t transport
+	switch config.Protocol {
+	case "", ProtocolGRPC:
+		grpcTransport, err := newGRPCTransport(config)
+		if err != nil {
+			return nil, err
+		}
+		t = grpcTransport
+	case ProtocolHTTP:
+		t = newHTTPTransport(config)
+	default:
+		return nil, fmt.Errorf("unknown otlp protocol: %v", config.Protocol)
+	}
+	return &Exporter{
+		config:         config,
+		cache:          cache,
+		useSlurm:       collectorConfig.UseSlurm,
+		cardinality:    collectorConfig.Cardinality,
+		gpuMetrics:     collector.SupportedGGPUMetricsName,
+		processMetrics: collector.SupportedProcessMetricsName,
+		transport:      t,
+		startTime:      time.Now(),
+		pending:        make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}, nil
+}
+
+// OnUpdate is meant to be registered as an NVMLCache update hook. Exports
+// run in Run, if one is still in flight the newest snapshot wins.
+func (e *Exporter) OnUpdate() {
+	select {
+	case e.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Exporter) Run(stop chan interface{}) {
+	defer close(e.done)
+	defer e.transport.close()
+	for {
+		select {
+		case <-stop:
+			logrus.Infof("Shutdown otlp exporter...")
+			return
+		case <-e.pending:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(e.config.Timeout))
+			if err := e.transport.export(ctx, e.buildRequest()); err != nil {
+				logrus.Errorf("OTLP export to %v failed: %v", e.config.Endpoint, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Done is closed once Run has returned
+func (e *Exporter) Done() <-chan struct{} {
+	return e.done
+}
+
+func (e *Exporter) buildRequest() *colmetricspb.ExportMetricsServiceRequest {
+	ts := uint64(e.cache.GetLastUpdate().UnixNano())
+	gpuStats := e.cache.GetGPUStats()
+	processStats := e.cache.GetProcessStats()
+
+	gpuInfos := make(map[uint]collector.GPUInfo)
+	for _, info := range e.cache.GetGPUInfos() {
+		gpuInfos[info.GPUIndex] = info
+	}
+
+	resourceMetrics := make([]*metricspb.ResourceMetrics, 0)
+	gpuUUIDs := make(map[int]string)
+	for _, gpu := range gpuStats {
+		gpuUUIDs[int(gpu.GPUIndex)] = gpu.UUID
+		metrics := make([]*metricspb.Metric, 0, len(e.gpuMetrics))
+		for _, name := range e.gpuMetrics {
+			// info labels are carried by the resource instead
+			if collector.IsGPUInfoMetric(name) {
+				continue
+			}
+			if !gpu.Up && !collector.IsGPUHealthMetric(name) {
+				continue
+			}
+			if collector.HasExtraLabels(name) {
+				labels := collector.METRIC_EXTRA_LABELS[name]
+				dps := make([]*metricspb.NumberDataPoint, 0)
+				for _, lv := range gpu.GetLabeledValuesFromMetricName(name) {
+					attrs := make([]*commonpb.KeyValue, 0, len(labels))
+					for i, label := range labels {
+						attrs = append(attrs, stringAttr(label, lv.LabelValues[i]))
+					}
+					dps = append(dps, e.newDataPoint(lv.Value, ts, attrs))
+				}
+				if len(dps) > 0 {
+					metrics = append(metrics, e.newMetric(name, dps...))
+				}
+				continue
+			}
+			if !gpu.HasValue(name) {
+				continue
+			}
+			dp := e.newDataPoint(gpu.GetValueFromMetricName(name), ts, nil)
+			metrics = append(metrics, e.newMetric(name, dp))
+		}
+		resource := []*commonpb.KeyValue{
+			stringAttr("host.name", e.cache.Hostname),
+			stringAttr("gpu.uuid", gpu.UUID),
+			stringAttr("gpu.index", fmt.Sprintf("%d", gpu.GPUIndex)),
+			stringAttr("gpu.model", gpu.GPUModelName),
+		}
+		if info, ok := gpuInfos[gpu.GPUIndex]; ok {
+			resource = append(resource,
+				stringAttr("gpu.driver.version", info.DriverVersion),
+				stringAttr("gpu.vbios.version", info.VBIOSVersion),
+				stringAttr("gpu.serial", info.Serial),
+				stringAttr("gpu.pci.bus_id", info.PCIBusID),
+				intAttr("gpu.minor_number", int64(info.MinorNumber)),
+				stringAttr("gpu.architecture", info.Architecture),
+				intAttr("gpu.numa_node", int64(info.NUMANode)),
+				stringAttr("gpu.cpu_affinity", info.CPUAffinity),
+			)
+		}
+		resourceMetrics = append(resourceMetrics, newResourceMetrics(resource, metrics))
+	}
+
+	// one resource per gpu and slurm job step
+	groups := make(map[string][]collector.ProcessStat)
+	for _, ps := range processStats {
+		key := fmt.Sprintf("%d/%s/%s", ps.GPUIndex, ps.SlurmJobID, ps.SlurmStepID)
+		groups[key] = append(groups[key], ps)
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		procs := groups[key]
+		metrics := make([]*metricspb.Metric, 0, len(e.processMetrics))
+		for _, name := range e.processMetrics {
+			dps := make([]*metricspb.NumberDataPoint, 0, len(procs))
+			for _, ps := range procs {
+				dps = append(dps, e.newDataPoint(ps.GetValueFromMetricName(name), ts, e.processAttrs(name, ps)))
+			}
+			metrics = append(metrics, e.newMetric(name, dps...))
+		}
+		first := procs[0]
+		resource := []*commonpb.KeyValue{
+			stringAttr("host.name", e.cache.Hostname),
+			stringAttr("gpu.uuid", gpuUUIDs[first.GPUIndex]),
+			stringAttr("gpu.index", fmt.Sprintf("%d", first.GPUIndex)),
+		}
+		if e.useSlurm {
+			resource = append(resource,
+				stringAttr("slurm.job.id", first.SlurmJobID),
+				stringAttr("slurm.step.id", first.SlurmStepID),
+				stringAttr("slurm.job.user", first.SlurmUser),
+				stringAttr("slurm.job.account", first.SlurmAccount),
+				stringAttr("slurm.job.name", first.SlurmJobName),
+			)
+		}
+		resourceMetrics = append(resourceMetrics, newResourceMetrics(resource, metrics))
+	}
+
+	return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: resourceMetrics}
+}
+
+func (e *Exporter) processAttrs(metricName string, ps collector.ProcessStat) []*commonpb.KeyValue {
+	attrs := []*commonpb.KeyValue{
+		intAttr("process.pid", int64(ps.Pid)),
+		intAttr("process.parent_pid", int64(ps.PPid)),
+		stringAttr("process.executable.name", ps.ProcName),
+		stringAttr("process.owner", ps.User),
+		stringAttr("process.status", ps.Status),
+	}
+	if metricName == collector.PROCESS_INFO {
+		// truncated or hashed as the cmdLine and workDir labels
+		workDir, cmdLine := e.cardinality.ProcessInfoValues(&ps)
+		attrs = append(attrs,
+			stringAttr("process.command_line", cmdLine),
+			stringAttr("process.working_directory", workDir),
+		)
+	}
+	return attrs
+}
+
+func (e *Exporter) newDataPoint(value float64, ts uint64, attrs []*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:   attrs,
+		TimeUnixNano: ts,
+		Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+// newMetric maps prometheus counters to monotonic cumulative sums and
+// everything else to gauges.
+func (e *Exporter) newMetric(name string, dps ...*metricspb.NumberDataPoint) *metricspb.Metric {
+	meta := collector.METRIC_META_MAP[name]
+	metric := &metricspb.Metric{
+		Name:        name,
+		Description: meta.Help,
+	}
+	if meta.PromType == prometheus.CounterValue {
+		for _, dp := range dps {
+			dp.StartTimeUnixNano = uint64(e.startTime.UnixNano())
+		}
+		metric.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             dps,
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}
+	} else {
+		metric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: dps}}
+	}
+	return metric
+}
+
+func newResourceMetrics(attrs []*commonpb.KeyValue, metrics []*metricspb.Metric) *metricspb.ResourceMetrics {
+	return &metricspb.ResourceMetrics{
+		Resource: &resourcepb.Resource{Attributes: attrs},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{
+			Scope:   &commonpb.InstrumentationScope{Name: scopeName},
+			Metrics: metrics,
+		}},
+	}
+}
+
+func stringAttr(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func intAttr(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}},
+	}
+}
@@ -0,0 +1,241 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// received is one export request and the headers it came with
+type received struct {
+	req     *colmetricspb.ExportMetricsServiceRequest
+	headers map[string]string
+}
+
+type grpcReceiver struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	requests chan received
+}
+
+func (r *grpcReceiver) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	headers := make(map[string]string)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		headers[k] = strings.Join(v, ",")
+	}
+	r.requests <- received{req, headers}
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+// startGRPCReceiver serves the OTLP metrics service on a local port
+func startGRPCReceiver(t *testing.T) (string, chan received) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver := &grpcReceiver{requests: make(chan received, 1)}
+	server := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(server, receiver)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String(), receiver.requests
+}
+
+// startHTTPReceiver serves OTLP/HTTP protobuf on /v1/metrics
+func startHTTPReceiver(t *testing.T) (string, chan received) {
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := &colmetricspb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		headers := make(map[string]string)
+		for k := range r.Header {
+			headers[strings.ToLower(k)] = r.Header.Get(k)
+		}
+		requests <- received{req, headers}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, requests
+}
+
+func newProcess(pid uint32, jobID string, cmdLine string) collector.ProcessStat {
+	ps := collector.ProcessStat{Pid: pid, GPUIndex: 0, ProcName: "python", User: "alice", CommandLine: cmdLine, GPUUsedMemoryBytes: 1 << 30}
+	ps.SlurmJobID = jobID
+	ps.SlurmStepID = "0"
+	return ps
+}
+
+func newCache() *collector.NVMLCache {
+	return &collector.NVMLCache{
+		Hostname:   "node1",
+		LastUpdate: time.Unix(1700000000, 0),
+		GPUStats: []collector.GPUStat{
+			{GPUIndex: 0, UUID: "GPU-a", Up: true, Temperature: 40, TotalEnergyConsumption: 2500},
+			{GPUIndex: 1, UUID: "GPU-b", Error: "GPU_IS_LOST"},
+		},
+		ProcessStats: map[string]collector.ProcessStat{
+			"1": newProcess(1, "100", "python train.py --epochs 10"),
+			"2": newProcess(2, "100", "python train.py --epochs 10"),
+			"3": newProcess(3, "200", "python eval.py"),
+		},
+	}
+}
+
+// export runs the exporter until the receiver got one request
+func export(t *testing.T, config Config, requests chan received) received {
+	t.Helper()
+	collectorConfig := &collector.Config{UseSlurm: true, Cardinality: collector.CardinalityConfig{CmdLineMaxLength: 15}}
+	e, err := NewExporter(config, collectorConfig, newCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan interface{})
+	go e.Run(stop)
+	defer func() {
+		close(stop)
+		<-e.Done()
+	}()
+	e.OnUpdate()
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no export received")
+	}
+	return received{}
+}
+
+func attrs(kvs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string)
+	for _, kv := range kvs {
+		switch v := kv.Value.Value.(type) {
+		case *commonpb.AnyValue_StringValue:
+			m[kv.Key] = v.StringValue
+		case *commonpb.AnyValue_IntValue:
+			m[kv.Key] = fmt.Sprintf("%d", v.IntValue)
+		}
+	}
+	return m
+}
+
+func metrics(rm *metricspb.ResourceMetrics) map[string]*metricspb.Metric {
+	m := make(map[string]*metricspb.Metric)
+	for _, sm := range rm.ScopeMetrics {
+		for _, metric := range sm.Metrics {
+			m[metric.Name] = metric
+		}
+	}
+	return m
+}
+
+func checkRequest(t *testing.T, req *colmetricspb.ExportMetricsServiceRequest) {
+	t.Helper()
+	// two gpus, then gpu 0 with job 100 and job 200
+	if len(req.ResourceMetrics) != 4 {
+		t.Fatalf("%d resources, want 4", len(req.ResourceMetrics))
+	}
+
+	up := req.ResourceMetrics[0]
+	if a := attrs(up.Resource.Attributes); a["gpu.uuid"] != "GPU-a" || a["host.name"] != "node1" {
+		t.Errorf("gpu resource %v", a)
+	}
+	m := metrics(up)
+	energy := m[collector.GPU_TOTAL_ENERGY_CONSUMPTION].GetSum()
+	if energy == nil || !energy.IsMonotonic || energy.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Errorf("%v is not a monotonic cumulative sum", collector.GPU_TOTAL_ENERGY_CONSUMPTION)
+	} else if dp := energy.DataPoints[0]; dp.GetAsDouble() != 2500 || dp.StartTimeUnixNano == 0 || dp.TimeUnixNano != uint64(time.Unix(1700000000, 0).UnixNano()) {
+		t.Errorf("energy data point %v", dp)
+	}
+	if gauge := m[collector.GPU_TEMPERATURE].GetGauge(); gauge == nil || gauge.DataPoints[0].GetAsDouble() != 40 {
+		t.Errorf("%v is not a gauge of 40", collector.GPU_TEMPERATURE)
+	}
+
+	down := metrics(req.ResourceMetrics[1])
+	if len(down) != 2 || down[collector.GPU_UP] == nil || down[collector.GPU_DOWN_INFO] == nil {
+		t.Errorf("down gpu has metrics %v", down)
+	} else if reason := attrs(down[collector.GPU_DOWN_INFO].GetGauge().DataPoints[0].Attributes)[collector.LabelReason]; reason != "GPU_IS_LOST" {
+		t.Errorf("down reason %q", reason)
+	}
+
+	for i, want := range []struct {
+		jobID string
+		procs int
+	}{{"100", 2}, {"200", 1}} {
+		rm := req.ResourceMetrics[2+i]
+		a := attrs(rm.Resource.Attributes)
+		if a["slurm.job.id"] != want.jobID || a["slurm.step.id"] != "0" || a["gpu.uuid"] != "GPU-a" {
+			t.Errorf("process resource %v, want job %v", a, want.jobID)
+		}
+		info := metrics(rm)[collector.PROCESS_INFO].GetGauge()
+		if info == nil || len(info.DataPoints) != want.procs {
+			t.Fatalf("job %v: process_info %v, want %d data points", want.jobID, info, want.procs)
+		}
+		for _, dp := range info.DataPoints {
+			if cmdLine := attrs(dp.Attributes)["process.command_line"]; len(cmdLine) > 15 {
+				t.Errorf("command line %q is not truncated", cmdLine)
+			}
+		}
+	}
+}
+
+func TestExportGRPC(t *testing.T) {
+	endpoint, requests := startGRPCReceiver(t)
+	r := export(t, Config{Endpoint: endpoint, Protocol: ProtocolGRPC, Insecure: true, Headers: map[string]string{"x-scope-orgid": "hpc"}}, requests)
+	if r.headers["x-scope-orgid"] != "hpc" {
+		t.Errorf("headers %v", r.headers)
+	}
+	checkRequest(t, r.req)
+}
+
+func TestExportHTTP(t *testing.T) {
+	endpoint, requests := startHTTPReceiver(t)
+	r := export(t, Config{Endpoint: endpoint, Protocol: ProtocolHTTP, Headers: map[string]string{"x-scope-orgid": "hpc"}}, requests)
+	if r.headers["x-scope-orgid"] != "hpc" {
+		t.Errorf("headers %v", r.headers)
+	}
+	checkRequest(t, r.req)
+}
+
+func TestHTTPTransportURL(t *testing.T) {
+	tests := []struct {
+		config Config
+		url    string
+	}{
+		{Config{Endpoint: "collector:4318", Insecure: true}, "http://collector:4318/v1/metrics"},
+		{Config{Endpoint: "collector:4318"}, "https://collector:4318/v1/metrics"},
+		{Config{Endpoint: "https://collector:4318/"}, "https://collector:4318/v1/metrics"},
+		{Config{Endpoint: "http://collector:4318/v1/metrics"}, "http://collector:4318/v1/metrics"},
+	}
+	for _, tt := range tests {
+		if url := newHTTPTransport(tt.config).url; url != tt.url {
+			t.Errorf("%v: %v, want %v", tt.config.Endpoint, url, tt.url)
+		}
+	}
+}
+
+func TestUnknownProtocol(t *testing.T) {
+	if _, err := NewExporter(Config{Endpoint: "x", Protocol: "udp"}, &collector.Config{}, newCache()); err == nil {
+		t.Error("unknown protocol accepted")
+	}
+}
@@ -0,0 +1,112 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+type transport interface {
+	export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error
+	close() error
+}
+
+type grpcTransport struct {
+	conn    *grpc.ClientConn
+	client  colmetricspb.MetricsServiceClient
+	headers metadata.MD
+}
+
+func newGRPCTransport(config Config) (*grpcTransport, error) {
+	creds := insecure.NewCredentials()
+	if !config.Insecure {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	// grpc dials lazily, an unreachable collector only fails on export
+	conn, err := grpc.Dial(config.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("cannot dial otlp endpoint %v, err: %v", config.Endpoint, err)
+	}
+	return &grpcTransport{
+		conn:    conn,
+		client:  colmetricspb.NewMetricsServiceClient(conn),
+		headers: metadata.New(config.Headers),
+	}, nil
+}
+
+func (t *grpcTransport) export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	ctx = metadata.NewOutgoingContext(ctx, t.headers)
+	_, err := t.client.Export(ctx, req)
+	return err
+}
+
+func (t *grpcTransport) close() error {
+	return t.conn.Close()
+}
+
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPTransport(config Config) *httpTransport {
+	url := config.Endpoint
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		if config.Insecure {
+			url = "http://" + url
+		} else {
+			url = "https://" + url
+		}
+	}
+	if !strings.HasSuffix(url, "/v1/metrics") {
+		url = strings.TrimSuffix(url, "/") + "/v1/metrics"
+	}
+	return &httpTransport{
+		url:     url,
+		headers: config.Headers,
+		client:  &http.Client{},
+	}
+}
+
+func (t *httpTransport) export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range t.headers {
+		httpReq.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (t *httpTransport) close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,283 @@
+package remotewrite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/nvml-exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	URL        string
+	BatchSize  int // max series per request
+	QueueSize  int // max series buffered in memory, newest are dropped when full
+	MaxRetries int
+	Timeout    time.Duration
+	// FlushInterval sends a partial batch after this long
+	FlushInterval time.Duration
+	// SpoolDir keeps the requests that still fail after MaxRetries on disk
+	// and resends them once the endpoint is back, disabled if empty
+	SpoolDir  string
+	SpoolSize int64 // max bytes spooled, oldest requests are dropped when full
+}
+
+// Client pushes every NVMLCache snapshot, as exposed by the registry, to a
+// prometheus remote write endpoint.
+type Client struct {
+	config   Config
+	gatherer prometheus.Gatherer
+	cache    *collector.NVMLCache
+	client   *http.Client
+	queue    chan TimeSeries
+	spool    *spool
+	done     chan struct{}
+	// first retry delay, doubled on every retry
+	backoff time.Duration
+}
+
+func NewClient(config Config, gatherer prometheus.Gatherer, cache *collector.NVMLCache) (*Client, error) {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.QueueSize < config.BatchSize {
+		config.QueueSize = config.BatchSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.SpoolSize <= 0 {
+		config.SpoolSize = 512 << 20
+	}
+	c := &Client{
+		config:   config,
+		gatherer: gatherer,
+		cache:    cache,
+		client:   &http.Client{Timeout: config.Timeout},
+		queue:    make(chan TimeSeries, config.QueueSize),
+		done:     make(chan struct{}),
+		backoff:  500 * time.Millisecond,
+	}
+	if config.SpoolDir != "" {
+		var err error
+		if c.spool, err = newSpool(config.SpoolDir, config.SpoolSize); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// OnUpdate is meant to be registered as an NVMLCache update hook, it only
+// enqueues so a slow endpoint never blocks collection.
+func (c *Client) OnUpdate() {
+	series, err := c.collect(c.cache.GetLastUpdate())
+	if err != nil {
+		logrus.Errorf("Failed to gather metrics for remote write: %v", err)
+		return
+	}
+	dropped := 0
+	for _, ts := range series {
+		select {
+		case c.queue <- ts:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		logrus.Warnf("Remote write queue full, dropped %d series", dropped)
+	}
+}
+
+// collect converts the gathered families into series stamped with the
+// cache collection time, not the push time.
+func (c *Client) collect(ts time.Time) ([]TimeSeries, error) {
+	mfs, err := c.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	timestamp := ts.UnixNano() / int64(time.Millisecond)
+	series := make([]TimeSeries, 0)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			var value float64
+			switch mf.GetType() {
+			case dto.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			case dto.MetricType_UNTYPED:
+				value = m.GetUntyped().GetValue()
+			default:
+				logrus.Debugf("remote write: skip unsupported metric type %v of %v", mf.GetType(), mf.GetName())
+				continue
+			}
+			labels := make([]Label, 0, len(m.GetLabel())+1)
+			labels = append(labels, Label{Name: "__name__", Value: mf.GetName()})
+			for _, lp := range m.GetLabel() {
+				labels = append(labels, Label{Name: lp.GetName(), Value: lp.GetValue()})
+			}
+			sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+			series = append(series, TimeSeries{
+				Labels:  labels,
+				Samples: []Sample{{Value: value, Timestamp: timestamp}},
+			})
+		}
+	}
+	return series, nil
+}
+
+// Run sends queued series in batches until stop is closed, then flushes
+// what is left.
+func (c *Client) Run(stop chan interface{}) {
+	defer close(c.done)
+	t := time.NewTicker(c.config.FlushInterval)
+	defer t.Stop()
+
+	batch := make([]TimeSeries, 0, c.config.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		body := snappy.Encode(nil, marshalWriteRequest(batch))
+		if retry, err := c.sendBody(body, stop); err != nil {
+			logrus.Errorf("Remote write of %d series failed: %v", len(batch), err)
+			if retry && c.spool != nil {
+				if err := c.spool.push(body); err != nil {
+					logrus.Errorf("Failed to spool remote write request, err: %v", err)
+				}
+			}
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-stop:
+			for {
+				select {
+				case ts := <-c.queue:
+					batch = append(batch, ts)
+					if len(batch) >= c.config.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					logrus.Infof("Shutdown remote write client...")
+					return
+				}
+			}
+		case ts := <-c.queue:
+			batch = append(batch, ts)
+			if len(batch) >= c.config.BatchSize {
+				flush()
+			}
+		case <-t.C:
+			flush()
+			c.replay()
+		}
+	}
+}
+
+// Done is closed once Run has flushed and returned
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// send retries on network errors and 5xx/429 with exponential backoff,
+// other status codes are not recoverable and the batch is dropped. Closing
+// stop ends the retries, the final flush is sent once.
+func (c *Client) send(series []TimeSeries, stop chan interface{}) error {
+	_, err := c.sendBody(snappy.Encode(nil, marshalWriteRequest(series)), stop)
+	return err
+}
+
+// sendBody is send of an encoded request, it also reports whether a failed
+// request is worth sending again later
+func (c *Client) sendBody(body []byte, stop chan interface{}) (bool, error) {
+	backoff := c.backoff
+	var err error
+	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-stop:
+				timer.Stop()
+				return true, fmt.Errorf("stopped while retrying, %v", err)
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+		var retry bool
+		retry, err = c.post(body)
+		if err == nil || !retry {
+			return retry, err
+		}
+		logrus.Debugf("remote write attempt %d failed: %v", attempt+1, err)
+	}
+	return true, err
+}
+
+// replay resends the spooled requests oldest first, it stops at the first
+// one the endpoint is still not ready for and goes on at the next tick
+func (c *Client) replay() {
+	if c.spool == nil {
+		return
+	}
+	names, err := c.spool.files()
+	if err != nil {
+		logrus.Errorf("Failed to list remote write spool, err: %v", err)
+		return
+	}
+	for _, name := range names {
+		body, err := os.ReadFile(name)
+		if err != nil {
+			logrus.Errorf("Failed to read spooled remote write request, err: %v", err)
+			os.Remove(name)
+			continue
+		}
+		retry, err := c.post(body)
+		if err != nil && retry {
+			logrus.Debugf("remote write replay of %v failed: %v", name, err)
+			return
+		}
+		if err != nil {
+			logrus.Errorf("Remote write of spooled request %v rejected: %v", name, err)
+		}
+		os.Remove(name)
+	}
+}
+
+func (c *Client) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, c.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "nvml-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	retry := resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, err
+}
@@ -0,0 +1,349 @@
+package remotewrite
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/nvml-exporter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// receiver is a remote write endpoint that records the decoded requests,
+// status returns the status code of the nth request, 204 if nil
+type receiver struct {
+	sync.Mutex
+	requests [][]TimeSeries
+	status   func(n int) int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+	n := len(r.requests)
+	compressed, _ := io.ReadAll(req.Body)
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil || req.Header.Get("Content-Encoding") != "snappy" {
+		http.Error(w, "bad encoding", http.StatusBadRequest)
+		return
+	}
+	series, err := unmarshalWriteRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.requests = append(r.requests, series)
+	status := http.StatusNoContent
+	if r.status != nil {
+		status = r.status(n)
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) batchSizes() []int {
+	r.Lock()
+	defer r.Unlock()
+	sizes := make([]int, 0, len(r.requests))
+	for _, series := range r.requests {
+		sizes = append(sizes, len(series))
+	}
+	return sizes
+}
+
+func unmarshalWriteRequest(b []byte) ([]TimeSeries, error) {
+	series := make([]TimeSeries, 0)
+	err := forEachField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		if num != 1 {
+			return fmt.Errorf("unexpected WriteRequest field %d", num)
+		}
+		var ts TimeSeries
+		err := forEachField(v, func(num protowire.Number, v []byte, _ uint64) error {
+			switch num {
+			case 1:
+				var l Label
+				err := forEachField(v, func(num protowire.Number, v []byte, _ uint64) error {
+					if num == 1 {
+						l.Name = string(v)
+					} else {
+						l.Value = string(v)
+					}
+					return nil
+				})
+				ts.Labels = append(ts.Labels, l)
+				return err
+			case 2:
+				var s Sample
+				err := forEachField(v, func(num protowire.Number, _ []byte, x uint64) error {
+					if num == 1 {
+						s.Value = math.Float64frombits(x)
+					} else {
+						s.Timestamp = int64(x)
+					}
+					return nil
+				})
+				ts.Samples = append(ts.Samples, s)
+				return err
+			}
+			return fmt.Errorf("unexpected TimeSeries field %d", num)
+		})
+		series = append(series, ts)
+		return err
+	})
+	return series, err
+}
+
+// forEachField calls f with the bytes of length-delimited fields and the
+// value of varint and fixed64 fields
+func forEachField(b []byte, f func(num protowire.Number, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var err error
+		switch typ {
+		case protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			if n >= 0 {
+				err = f(num, v, 0)
+			}
+		case protowire.VarintType:
+			var x uint64
+			x, n = protowire.ConsumeVarint(b)
+			if n >= 0 {
+				err = f(num, nil, x)
+			}
+		case protowire.Fixed64Type:
+			var x uint64
+			x, n = protowire.ConsumeFixed64(b)
+			if n >= 0 {
+				err = f(num, nil, x)
+			}
+		default:
+			return fmt.Errorf("unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// newTestClient returns a client of a registry with one gauge series per gpu
+func newTestClient(t *testing.T, url string, config Config, gpus int) *Client {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "gpu_temperature"}, []string{"gpu"})
+	registry.MustRegister(gauge)
+	for i := 0; i < gpus; i++ {
+		gauge.WithLabelValues(fmt.Sprintf("%d", i)).Set(float64(40 + i))
+	}
+	config.URL = url
+	c, err := NewClient(config, registry, &collector.NVMLCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.backoff = time.Millisecond
+	return c
+}
+
+// runOnce pushes one update through Run and waits for the final flush
+func runOnce(c *Client) {
+	stop := make(chan interface{})
+	go c.Run(stop)
+	c.OnUpdate()
+	close(stop)
+	<-c.Done()
+}
+
+func TestBatching(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, Config{BatchSize: 3, QueueSize: 10, FlushInterval: time.Hour}, 7)
+	runOnce(c)
+
+	sizes := r.batchSizes()
+	total := 0
+	for _, size := range sizes {
+		if size > 3 {
+			t.Errorf("batch of %d series, BatchSize is 3", size)
+		}
+		total += size
+	}
+	if total != 7 || len(sizes) != 3 {
+		t.Errorf("batches %v, want 7 series in 3 batches", sizes)
+	}
+	ts := r.requests[0][0]
+	if ts.Labels[0].Name != "__name__" || ts.Labels[0].Value != "gpu_temperature" {
+		t.Errorf("labels %v, want __name__ first", ts.Labels)
+	}
+	if len(ts.Samples) != 1 || ts.Samples[0].Value < 40 {
+		t.Errorf("samples %v", ts.Samples)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   func(n int) int
+		requests int
+	}{
+		{"recovers after 5xx", func(n int) int {
+			if n < 2 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusNoContent
+		}, 3},
+		{"retries 429", func(n int) int {
+			if n == 0 {
+				return http.StatusTooManyRequests
+			}
+			return http.StatusNoContent
+		}, 2},
+		{"gives up after MaxRetries", func(int) int { return http.StatusInternalServerError }, 3},
+		{"does not retry 4xx", func(int) int { return http.StatusBadRequest }, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &receiver{status: tt.status}
+			server := httptest.NewServer(r)
+			defer server.Close()
+
+			c := newTestClient(t, server.URL, Config{MaxRetries: 2}, 2)
+			series, err := c.collect(time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.send(series, make(chan interface{}))
+			if sizes := r.batchSizes(); len(sizes) != tt.requests {
+				t.Errorf("%d requests, want %d", len(sizes), tt.requests)
+			}
+		})
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	c := newTestClient(t, "http://127.0.0.1:0", Config{BatchSize: 2, QueueSize: 2}, 5)
+	c.OnUpdate()
+	if len(c.queue) != 2 {
+		t.Errorf("%d series queued, want 2 with 3 dropped", len(c.queue))
+	}
+}
+
+func TestStopInterruptsBackoff(t *testing.T) {
+	r := &receiver{status: func(int) int { return http.StatusServiceUnavailable }}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, Config{MaxRetries: 5}, 1)
+	c.backoff = time.Hour
+	stop := make(chan interface{})
+	errc := make(chan error)
+	go func() {
+		errc <- c.send([]TimeSeries{{Labels: []Label{{Name: "__name__", Value: "up"}}}}, stop)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("send succeeded against a failing endpoint")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("send did not return after stop")
+	}
+}
+
+func TestSpoolTrim(t *testing.T) {
+	s, err := newSpool(t.TempDir(), 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := s.push([]byte(fmt.Sprintf("request-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := s.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 9 bytes each, only the 2 newest fit
+	if len(names) != 2 {
+		t.Fatalf("%d spooled requests, want 2", len(names))
+	}
+	if body, _ := os.ReadFile(names[0]); string(body) != "request-2" {
+		t.Errorf("oldest spooled request %q, want request-2", body)
+	}
+	entries, _ := os.ReadDir(s.dir)
+	if len(entries) != 2 {
+		t.Errorf("%d files in spool dir, temp files left behind", len(entries))
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	r := &receiver{status: func(int) int {
+		if down.Load() {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusNoContent
+	}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	dir := t.TempDir()
+	c := newTestClient(t, server.URL, Config{MaxRetries: 1, SpoolDir: dir}, 2)
+	runOnce(c)
+	if names, _ := c.spool.files(); len(names) != 1 {
+		t.Fatalf("%d spooled requests, want 1", len(names))
+	}
+
+	// still down, the request stays in the spool
+	c.replay()
+	if names, _ := c.spool.files(); len(names) != 1 {
+		t.Fatalf("%d spooled requests after a failed replay, want 1", len(names))
+	}
+
+	// a new client on the same dir, as after a restart
+	down.Store(false)
+	c = newTestClient(t, server.URL, Config{SpoolDir: dir}, 2)
+	c.replay()
+	if names, _ := c.spool.files(); len(names) != 0 {
+		t.Errorf("%d spooled requests after replay, want 0", len(names))
+	}
+	sizes := r.batchSizes()
+	if last := sizes[len(sizes)-1]; last != 2 {
+		t.Errorf("replayed %d series, want 2", last)
+	}
+}
+
+func TestSpoolSkipsRejected(t *testing.T) {
+	r := &receiver{status: func(int) int { return http.StatusBadRequest }}
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	c := newTestClient(t, server.URL, Config{SpoolDir: t.TempDir()}, 1)
+	runOnce(c)
+	if names, _ := c.spool.files(); len(names) != 0 {
+		t.Errorf("%d spooled requests, a rejected request is not spooled", len(names))
+	}
+}
@@ -0,0 +1,96 @@
+package remotewrite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const spoolExt = ".snappy"
+
+// spool keeps the encoded requests that could not be sent in a directory,
+// one file per request named by its spool time. When the files exceed
+// maxBytes the oldest are removed.
+type spool struct {
+	dir      string
+	maxBytes int64
+	seq      uint64
+}
+
+func newSpool(dir string, maxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir %v, err: %v", dir, err)
+	}
+	return &spool{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// push writes body through a temp file in the same dir, so a crash never
+// leaves a partial request behind
+func (s *spool) push(body []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".spool-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), atomic.AddUint64(&s.seq, 1)%1000000, spoolExt)
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return err
+	}
+	return s.trim()
+}
+
+// files returns the spooled requests, oldest first
+func (s *spool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), spoolExt) {
+			names = append(names, filepath.Join(s.dir, e.Name()))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// trim removes the oldest requests until the spool fits in maxBytes
+func (s *spool) trim() error {
+	names, err := s.files()
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, len(names))
+	var total int64
+	for i, name := range names {
+		if fi, err := os.Stat(name); err == nil {
+			sizes[i] = fi.Size()
+			total += fi.Size()
+		}
+	}
+	removed := 0
+	for ; removed < len(names) && total > s.maxBytes; removed++ {
+		if err := os.Remove(names[removed]); err != nil {
+			return err
+		}
+		total -= sizes[removed]
+	}
+	if removed > 0 {
+		logrus.Warnf("Remote write spool full, dropped %d oldest requests", removed)
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+)
+
+const (
+	influxGPUMeasurement     = "nvml_gpu"
+	influxProcessMeasurement = "nvml_process"
+
+	// keep datagrams below a typical MTU
+	influxUDPPayloadSize = 1400
+)
+
+type InfluxDBConfig struct {
+	// http(s)://host:8086/api/v2/write?org=..&bucket=..&precision=ns,
+	// http(s)://host:8086/write?db=.. for 1.x, or udp://host:8089
+	URL      string `yaml:"url"`
+	Token    string `yaml:"token"` // 2.x api token
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Timeout  int    `yaml:"timeout"` // seconds
+}
+
+// InfluxDBSink writes every snapshot as line protocol, one point per GPU and
+// one per process, with nanosecond timestamps.
+type InfluxDBSink struct {
+	config InfluxDBConfig
+	client *http.Client
+	conn   net.Conn
+}
+
+func NewInfluxDBSink(config InfluxDBConfig) (*InfluxDBSink, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10
+	}
+	s := &InfluxDBSink{config: config}
+	switch u.Scheme {
+	case "udp":
+		s.conn, err = net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+	case "http", "https":
+		s.client = &http.Client{Timeout: time.Second * time.Duration(config.Timeout)}
+	default:
+		return nil, fmt.Errorf("unsupported scheme: %v", u.Scheme)
+	}
+	return s, nil
+}
+
+func (s *InfluxDBSink) Name() string {
+	return "influxdb:" + s.config.URL
+}
+
+func (s *InfluxDBSink) Write(snapshot *Snapshot) error {
+	lines := influxLines(snapshot)
+	if s.conn != nil {
+		return s.writeUDP(lines)
+	}
+	return s.writeHTTP(lines)
+}
+
+func (s *InfluxDBSink) writeHTTP(lines []string) error {
+	body := strings.Join(lines, "\n")
+	req, err := http.NewRequest(http.MethodPost, s.config.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.config.Token)
+	} else if s.config.Username != "" {
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (s *InfluxDBSink) writeUDP(lines []string) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+len(line)+1 > influxUDPPayloadSize {
+			if _, err := s.conn.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if buf.Len() > 0 {
+		if _, err := s.conn.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *InfluxDBSink) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func influxLines(snapshot *Snapshot) []string {
+	ts := snapshot.Time.UnixNano()
+	lines := make([]string, 0, len(snapshot.GPUStats)+len(snapshot.ProcessStats))
+	for _, gpu := range snapshot.GPUStats {
+		tags := map[string]string{
+			"host":        snapshot.Hostname,
+			"gpu":         gpu.GPULabel,
+			"UUID":        gpu.UUID,
+			"modelName":   gpu.GPUModelName,
+			"pciBusID":    gpu.PCIBusID,
+			"minorNumber": minorTag(gpu.MinorNumber),
+		}
+		fields := make(map[string]float64)
+		for _, name := range collector.SupportedGGPUMetricsName {
+			if collector.IsGPUInfoMetric(name) {
+				continue
+			}
+			// one field per series, e.g. gpu_clock_max_sm
+			if collector.HasExtraLabels(name) {
+				for _, lv := range gpu.GetLabeledValuesFromMetricName(name) {
+					fields[name+"_"+strings.Join(lv.LabelValues, "_")] = lv.Value
+				}
+				continue
+			}
+			if gpu.HasValue(name) {
+				fields[name] = gpu.GetValueFromMetricName(name)
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		lines = append(lines, influxLine(influxGPUMeasurement, tags, fields, ts))
+	}
+	for _, ps := range snapshot.ProcessStats {
+		tags := map[string]string{
+			"host":         snapshot.Hostname,
+			"gpu":          ps.GPULabel,
+			"pid":          fmt.Sprintf("%d", ps.Pid),
+			"procName":     ps.ProcName,
+			"user":         ps.User,
+			"slurmJobID":   ps.SlurmJobID,
+			"slurmStepID":  ps.SlurmStepID,
+			"slurmUser":    ps.SlurmUser,
+			"slurmAccount": ps.SlurmAccount,
+			"slurmJobName": ps.SlurmJobName,
+		}
+		if gpu := snapshot.GPU(ps.GPUIndex); gpu != nil {
+			tags["UUID"] = gpu.UUID
+			tags["pciBusID"] = gpu.PCIBusID
+			tags["minorNumber"] = minorTag(gpu.MinorNumber)
+		}
+		fields := make(map[string]float64)
+		for _, name := range collector.SupportedProcessMetricsName {
+			if name == collector.PROCESS_INFO {
+				continue
+			}
+			fields[name] = ps.GetValueFromMetricName(name)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		lines = append(lines, influxLine(influxProcessMeasurement, tags, fields, ts))
+	}
+	return lines
+}
+
+// minorTag is the minorNumber tag, empty and so omitted if unknown
+func minorTag(minor int) string {
+	if minor < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d", minor)
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// influxLine renders one point, tags are sorted and empty tags are omitted
+// since line protocol does not allow empty tag values.
+func influxLine(measurement string, tags map[string]string, fields map[string]float64, ts int64) string {
+	var b strings.Builder
+	b.WriteString(influxMeasurementEscaper.Replace(measurement))
+
+	tagKeys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			tagKeys = append(tagKeys, k)
+		}
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		b.WriteByte(',')
+		b.WriteString(influxTagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(influxTagEscaper.Replace(tags[k]))
+	}
+
+	fieldKeys := make([]string, 0, len(fields))
+	for k := range fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+	for i, k := range fieldKeys {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(influxTagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(fields[k], 'f', -1, 64))
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(ts, 10))
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package sink
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+)
+
+func TestInfluxLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		measurement string
+		tags        map[string]string
+		fields      map[string]float64
+		want        string
+	}{
+		{"sorted", "nvml_gpu",
+			map[string]string{"host": "node1", "gpu": "0"},
+			map[string]float64{"gpu_util": 87, "gpu_temperature": 40.5},
+			"nvml_gpu,gpu=0,host=node1 gpu_temperature=40.5,gpu_util=87 1700000000000000000"},
+		{"empty tags omitted", "nvml_process",
+			map[string]string{"pid": "42", "slurmJobID": ""},
+			map[string]float64{"process_gpu_memory_used": 1024},
+			"nvml_process,pid=42 process_gpu_memory_used=1024 1700000000000000000"},
+		{"escaped", "nvml gpu,x",
+			map[string]string{"modelName": "Tesla T4", "procName": "a=b,c"},
+			map[string]float64{"big": 1e21},
+			`nvml\ gpu\,x,modelName=Tesla\ T4,procName=a\=b\,c big=1000000000000000000000 1700000000000000000`},
+	}
+	for _, tt := range tests {
+		if got := influxLine(tt.measurement, tt.tags, tt.fields, 1700000000000000000); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInfluxDBSinkHTTP(t *testing.T) {
+	var body, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body, auth = string(b), r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	s, err := NewInfluxDBSink(InfluxDBConfig{URL: server.URL + "/api/v2/write?org=o&bucket=b", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	snapshot := &Snapshot{
+		Time:     time.Unix(1700000000, 0),
+		Hostname: "node1",
+		GPUStats: []collector.GPUStat{{GPUIndex: 0, UUID: "GPU-a", PCIBusID: "00000000:3B:00.0", MinorNumber: 2, GPULabel: "2", Up: true}},
+		ProcessStats: map[string]collector.ProcessStat{
+			"0_42": {Pid: 42, GPUIndex: 0, GPULabel: "2", ProcName: "python"},
+		},
+	}
+	if err := s.Write(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Token secret" {
+		t.Errorf("Authorization %q", auth)
+	}
+	lines := strings.Split(body, "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), body)
+	}
+	if !strings.HasPrefix(lines[0], "nvml_gpu,UUID=GPU-a,gpu=2,host=node1,minorNumber=2,pciBusID=00000000:3B:00.0 ") || !strings.HasSuffix(lines[0], " 1700000000000000000") {
+		t.Errorf("gpu line %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "nvml_process,UUID=GPU-a,gpu=2,host=node1,minorNumber=2,pciBusID=00000000:3B:00.0,pid=42,procName=python ") {
+		t.Errorf("process line %q", lines[1])
+	}
+}
@@ -0,0 +1,139 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+)
+
+type JSONLinesConfig struct {
+	Path       string `yaml:"path"`
+	MaxSizeMB  int    `yaml:"maxSizeMB"`  // rotate when the file grows beyond, default 100
+	MaxBackups int    `yaml:"maxBackups"` // rotated files kept as path.1 .. path.N, default 5
+}
+
+type gpuRow struct {
+	Time time.Time `json:"time"`
+	Host string    `json:"host"`
+	Type string    `json:"type"`
+	collector.GPUStat
+}
+
+type processRow struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	Type    string    `json:"type"`
+	GPUUUID string    `json:"UUID"`
+	collector.ProcessStat
+}
+
+// JSONLinesSink appends one json object per GPU and per process to a file,
+// rows are distinguished by their "type" field.
+type JSONLinesSink struct {
+	config JSONLinesConfig
+	file   *os.File
+	size   int64
+}
+
+func NewJSONLinesSink(config JSONLinesConfig) (*JSONLinesSink, error) {
+	if config.MaxSizeMB <= 0 {
+		config.MaxSizeMB = 100
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = 5
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0755); err != nil {
+		return nil, err
+	}
+	s := &JSONLinesSink{config: config}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONLinesSink) Name() string {
+	return "jsonl:" + s.config.Path
+}
+
+func (s *JSONLinesSink) open() error {
+	f, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts path.N-1 to path.N ... path to path.1, the oldest is removed
+func (s *JSONLinesSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(fmt.Sprintf("%s.%d", s.config.Path, s.config.MaxBackups))
+	for i := s.config.MaxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.config.Path, i), fmt.Sprintf("%s.%d", s.config.Path, i+1))
+	}
+	if err := os.Rename(s.config.Path, s.config.Path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *JSONLinesSink) Write(snapshot *Snapshot) error {
+	if s.size >= int64(s.config.MaxSizeMB)*1024*1024 {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotate failed, err: %v", err)
+		}
+	}
+	// count what reaches the file, bufio flushes on its own past its buffer size
+	w := bufio.NewWriter(&countingWriter{w: s.file, n: &s.size})
+	enc := json.NewEncoder(w)
+	for _, gpu := range snapshot.GPUStats {
+		row := gpuRow{Time: snapshot.Time, Host: snapshot.Hostname, Type: "gpu", GPUStat: gpu}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	for _, ps := range snapshot.ProcessStats {
+		row := processRow{
+			Time:        snapshot.Time,
+			Host:        snapshot.Hostname,
+			Type:        "process",
+			GPUUUID:     snapshot.GPUUUID(ps.GPUIndex),
+			ProcessStat: ps,
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// countingWriter adds the bytes written to w to n
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
+
+func (s *JSONLinesSink) Close() error {
+	return s.file.Close()
+}
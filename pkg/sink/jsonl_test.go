@@ -0,0 +1,48 @@
+package sink
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+)
+
+func TestJSONLinesSinkRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	s, err := NewJSONLinesSink(JSONLinesConfig{Path: path, MaxSizeMB: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	snapshot := &Snapshot{Time: time.Now(), Hostname: "node1"}
+	for i := 0; i < 1000; i++ {
+		snapshot.GPUStats = append(snapshot.GPUStats, collector.GPUStat{UUID: "GPU-a", Up: true})
+	}
+	// each write is larger than the bufio buffer, the file passes 1 MiB
+	// after a few writes
+	for i := 0; i < 20; i++ {
+		if err := s.Write(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.size != info.Size() {
+		t.Errorf("counted %d bytes, file has %d", s.size, info.Size())
+	}
+	if info.Size() > 2*1024*1024 {
+		t.Errorf("file grew to %d bytes without rotating", info.Size())
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Errorf("no rotated file, err: %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("more than MaxBackups rotated files")
+	}
+}
@@ -0,0 +1,126 @@
+package sink
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nvml-exporter/pkg/collector"
+	"github.com/sirupsen/logrus"
+)
+
+// Snapshot is one NVMLCache update handed to every sink
+type Snapshot struct {
+	Time         time.Time
+	Hostname     string
+	GPUStats     []collector.GPUStat
+	ProcessStats map[string]collector.ProcessStat
+}
+
+// GPUUUID returns the uuid of the gpu a process runs on
+func (s *Snapshot) GPUUUID(gpuIndex int) string {
+	if gpu := s.GPU(gpuIndex); gpu != nil {
+		return gpu.UUID
+	}
+	return ""
+}
+
+// GPU returns the stat of the gpu a process runs on, nil if not found
+func (s *Snapshot) GPU(gpuIndex int) *collector.GPUStat {
+	for i := range s.GPUStats {
+		if int(s.GPUStats[i].GPUIndex) == gpuIndex {
+			return &s.GPUStats[i]
+		}
+	}
+	return nil
+}
+
+type Sink interface {
+	Name() string
+	Write(s *Snapshot) error
+	Close() error
+}
+
+// Config is the `sinks` section of the metric config file
+type Config struct {
+	InfluxDB  []InfluxDBConfig  `yaml:"influxdb"`
+	JSONLines []JSONLinesConfig `yaml:"jsonl"`
+}
+
+func NewSinks(config Config) ([]Sink, error) {
+	sinks := make([]Sink, 0)
+	for _, c := range config.InfluxDB {
+		s, err := NewInfluxDBSink(c)
+		if err != nil {
+			return nil, fmt.Errorf("init influxdb sink %v failed, err: %v", c.URL, err)
+		}
+		sinks = append(sinks, s)
+	}
+	for _, c := range config.JSONLines {
+		s, err := NewJSONLinesSink(c)
+		if err != nil {
+			return nil, fmt.Errorf("init jsonl sink %v failed, err: %v", c.Path, err)
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+// Manager feeds every cache snapshot to the sinks without blocking collection.
+// If the sinks fall behind, intermediate snapshots are skipped.
+type Manager struct {
+	cache   *collector.NVMLCache
+	sinks   []Sink
+	pending chan *Snapshot
+	done    chan struct{}
+}
+
+func NewManager(cache *collector.NVMLCache, sinks []Sink) *Manager {
+	return &Manager{
+		cache:   cache,
+		sinks:   sinks,
+		pending: make(chan *Snapshot, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// OnUpdate is meant to be registered as an NVMLCache update hook
+func (m *Manager) OnUpdate() {
+	snapshot := &Snapshot{
+		Time:         m.cache.GetLastUpdate(),
+		Hostname:     m.cache.Hostname,
+		GPUStats:     m.cache.GetGPUStats(),
+		ProcessStats: m.cache.GetProcessStats(),
+	}
+	select {
+	case m.pending <- snapshot:
+	default:
+		logrus.Warnf("Sinks are busy, skip snapshot of %v", snapshot.Time)
+	}
+}
+
+func (m *Manager) Run(stop chan interface{}) {
+	defer close(m.done)
+	for {
+		select {
+		case <-stop:
+			for _, s := range m.sinks {
+				if err := s.Close(); err != nil {
+					logrus.Errorf("Close sink %v failed: %v", s.Name(), err)
+				}
+			}
+			logrus.Infof("Shutdown sinks...")
+			return
+		case snapshot := <-m.pending:
+			for _, s := range m.sinks {
+				if err := s.Write(snapshot); err != nil {
+					logrus.Errorf("Write to sink %v failed: %v", s.Name(), err)
+				}
+			}
+		}
+	}
+}
+
+// Done is closed once Run has returned
+func (m *Manager) Done() <-chan struct{} {
+	return m.done
+}
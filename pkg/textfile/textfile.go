@@ -0,0 +1,71 @@
+package textfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+)
+
+// Writer dumps everything a gatherer exposes into a node_exporter
+// textfile collector directory.
+type Writer struct {
+	gatherer prometheus.Gatherer
+	dir      string
+	name     string
+}
+
+func NewWriter(gatherer prometheus.Gatherer, dir string, name string) *Writer {
+	return &Writer{
+		gatherer: gatherer,
+		dir:      dir,
+		name:     name,
+	}
+}
+
+func (w *Writer) Path() string {
+	return filepath.Join(w.dir, w.name)
+}
+
+// Write gathers the registry and atomically replaces the .prom file, so
+// node_exporter never reads a half written exposition.
+func (w *Writer) Write() error {
+	mfs, err := w.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gather metrics failed, err: %v", err)
+	}
+
+	// node_exporter only reads *.prom, the temp file is ignored until renamed
+	tmp, err := os.CreateTemp(w.dir, "."+w.name+".tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create temp file in %v, err: %v", w.dir, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(tmp, mf); err != nil {
+			tmp.Close()
+			return fmt.Errorf("write metric family %v failed, err: %v", mf.GetName(), err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file failed, err: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("chmod temp file failed, err: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), w.Path()); err != nil {
+		return fmt.Errorf("rename %v to %v failed, err: %v", tmp.Name(), w.Path(), err)
+	}
+	return nil
+}
+
+// OnUpdate is meant to be registered as an NVMLCache update hook
+func (w *Writer) OnUpdate() {
+	if err := w.Write(); err != nil {
+		logrus.Errorf("Failed to write textfile %v: %v", w.Path(), err)
+	}
+}
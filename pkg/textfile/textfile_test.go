@@ -0,0 +1,71 @@
+package textfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestWriter(t *testing.T) (*Writer, prometheus.Gauge) {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "gpu_temperature"})
+	registry.MustRegister(gauge)
+	return NewWriter(registry, t.TempDir(), "nvml.prom"), gauge
+}
+
+func TestWrite(t *testing.T) {
+	w, gauge := newTestWriter(t)
+	gauge.Set(40)
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(w.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// node_exporter may run as another user
+	if fi.Mode().Perm() != 0644 {
+		t.Errorf("mode %v, want 0644", fi.Mode().Perm())
+	}
+
+	gauge.Set(41)
+	if err := w.Write(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(w.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "gpu_temperature 41\n") || strings.Contains(string(b), "gpu_temperature 40\n") {
+		t.Errorf("second write did not replace the first:\n%s", b)
+	}
+	entries, _ := os.ReadDir(w.dir)
+	if len(entries) != 1 {
+		t.Errorf("%d files in %v, temp files left behind", len(entries), w.dir)
+	}
+}
+
+// TestWriteTempInDir makes the rename fail to check the temp file is created
+// next to the target, a rename from another filesystem would not be atomic
+func TestWriteTempInDir(t *testing.T) {
+	w, _ := newTestWriter(t)
+	if err := os.Mkdir(w.Path(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := w.Write()
+	if err == nil {
+		t.Fatal("rename onto a directory succeeded")
+	}
+	// rename <tmp> to <path> failed, err: ...
+	tmp := strings.Fields(strings.TrimPrefix(err.Error(), "rename "))[0]
+	if filepath.Dir(tmp) != w.dir || !strings.HasPrefix(filepath.Base(tmp), ".nvml.prom.tmp") {
+		t.Errorf("temp file %v, want a hidden file in %v", tmp, w.dir)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temp file %v not removed after a failed write", tmp)
+	}
+}